@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/digitalocean/app_action/utils"
 	"github.com/digitalocean/godo"
@@ -31,10 +33,10 @@ func main() {
 
 	do := godo.NewFromToken(in.token)
 	do.UserAgent = "do-app-action-delete"
+	apps := utils.NewRetryingAppsService(do.Apps, a.Debugf)
 
-	appID := in.appID
+	appID, appName := in.appID, in.appName
 	if appID == "" {
-		appName := in.appName
 		if appName == "" {
 			repoOwner, repo := ghCtx.Repo()
 			prRef, err := utils.PRRefFromContext(ghCtx)
@@ -44,13 +46,14 @@ func main() {
 			appName = utils.GenerateAppName(repoOwner, repo, prRef)
 		}
 
-		app, err := utils.FindAppByName(ctx, do.Apps, appName)
+		app, err := utils.FindAppByName(ctx, apps, appName)
 		if err != nil {
 			a.Fatalf("failed to find app: %v", err)
 		}
 		if app == nil {
 			if in.ignoreNotFound {
 				a.Infof("app %q not found, ignoring", appName)
+				utils.AddStepSummary(a, deleteSummary(appName, "", false))
 				return
 			}
 			a.Fatalf("app %q not found", appName)
@@ -58,11 +61,31 @@ func main() {
 		appID = app.ID
 	}
 
-	if resp, err := do.Apps.Delete(ctx, appID); err != nil {
+	if resp, err := apps.Delete(ctx, appID); err != nil {
 		if resp.StatusCode == http.StatusNotFound && in.ignoreNotFound {
 			a.Infof("app %q not found, ignoring", appID)
+			utils.AddStepSummary(a, deleteSummary(appName, appID, false))
 			return
 		}
 		a.Fatalf("failed to delete app: %v", err)
 	}
+	utils.AddStepSummary(a, deleteSummary(appName, appID, true))
+}
+
+// deleteSummary renders a markdown summary of the deletion for the job summary.
+func deleteSummary(appName, appID string, deleted bool) string {
+	var b strings.Builder
+	if deleted {
+		b.WriteString("### :wastebasket: Deleted app\n\n")
+	} else {
+		b.WriteString("### :information_source: App not found, nothing deleted\n\n")
+	}
+	b.WriteString("| | |\n| --- | --- |\n")
+	if appName != "" {
+		fmt.Fprintf(&b, "| Name | `%s` |\n", appName)
+	}
+	if appID != "" {
+		fmt.Fprintf(&b, "| ID | `%s` |\n", appID)
+	}
+	return b.String()
 }
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/digitalocean/godo"
+	"sigs.k8s.io/yaml"
+)
+
+// buildContextKey is the annotation of image components in the app spec that
+// defines the context to build their image from in build mode.
+const buildContextKey = "build_context"
+
+// commandRunner runs the given command, passing it the given input if any.
+type commandRunner func(ctx context.Context, stdin io.Reader, name string, args ...string) error
+
+// runCommand runs the given command, streaming its output to the action's output.
+func runCommand(ctx context.Context, stdin io.Reader, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// buildContexts returns the build contexts annotated on the components of the given
+// app spec source, keyed by component name.
+func buildContexts(source []byte) (map[string]string, error) {
+	var spec map[string]any
+	if err := yaml.Unmarshal(source, &spec); err != nil {
+		return nil, fmt.Errorf("failed to parse app spec: %w", err)
+	}
+
+	contexts := make(map[string]string)
+	for _, key := range componentSpecKeys {
+		components, _ := spec[key].([]any)
+		for _, c := range components {
+			c, _ := c.(map[string]any)
+			buildContext, ok := c[buildContextKey]
+			if !ok {
+				continue
+			}
+			name, _ := c["name"].(string)
+			dir, ok := buildContext.(string)
+			if !ok || dir == "" {
+				return nil, fmt.Errorf("%s of component %q must be a path", buildContextKey, name)
+			}
+			contexts[name] = dir
+		}
+	}
+	return contexts, nil
+}
+
+// buildImages builds the images of all components with a build context using the
+// local Docker daemon and pushes them to DOCR, tagged with the current commit.
+// The pushed images' digests are passed on to replaceImagesInSpec through the
+// deployer's variables.
+func (d *deployer) buildImages(ctx context.Context, spec *godo.AppSpec) error {
+	contexts, err := buildContexts(d.specSource)
+	if err != nil {
+		return err
+	}
+	if len(contexts) == 0 {
+		return fmt.Errorf("no component defines a %s", buildContextKey)
+	}
+	sha := d.action.Getenv("GITHUB_SHA")
+	if sha == "" {
+		return fmt.Errorf("GITHUB_SHA is not set")
+	}
+
+	// Collect the images first to fail early if any is misconfigured.
+	images := make(map[string]*godo.ImageSourceSpec, len(contexts))
+	_ = godo.ForEachAppSpecComponent(spec, func(c godo.AppContainerComponentSpec) error {
+		if _, ok := contexts[c.GetName()]; ok {
+			images[c.GetName()] = c.GetImage()
+		}
+		return nil
+	})
+	names := make([]string, 0, len(contexts))
+	for name := range contexts {
+		image := images[name]
+		if image == nil {
+			return fmt.Errorf("component %q must be deployed from an image to be built", name)
+		}
+		if image.GetRegistryType() != godo.ImageSourceSpecRegistryType_DOCR || image.GetRegistry() == "" {
+			return fmt.Errorf("component %q must be deployed from a DOCR image with its registry set to be built", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if err := d.run(ctx, strings.NewReader(d.inputs.token), "docker", "login", docrHost, "--username", docrUsername, "--password-stdin"); err != nil {
+		return fmt.Errorf("failed to log in to %s: %w", docrHost, err)
+	}
+
+	registry := &registryClient{httpClient: d.httpClient}
+	env := make(map[string]string, len(d.env)+len(names))
+	for k, v := range d.env {
+		env[k] = v
+	}
+	for _, name := range names {
+		img, err := registryImageFromSpec(&godo.ImageSourceSpec{
+			RegistryType: godo.ImageSourceSpecRegistryType_DOCR,
+			Registry:     images[name].GetRegistry(),
+			Repository:   images[name].GetRepository(),
+			Tag:          sha,
+		}, d.inputs.token)
+		if err != nil {
+			return fmt.Errorf("component %q: %w", name, err)
+		}
+
+		d.action.Group(fmt.Sprintf("build image of component %q", name))
+		err = d.run(ctx, nil, "docker", "build", "--platform", "linux/amd64", "--tag", img.String(), contexts[name])
+		if err == nil {
+			err = d.run(ctx, nil, "docker", "push", img.String())
+		}
+		d.action.EndGroup()
+		if err != nil {
+			return fmt.Errorf("failed to build and push image %s of component %q: %w", img, name, err)
+		}
+
+		digest, err := registry.manifestDigest(ctx, img)
+		if err != nil {
+			return fmt.Errorf("failed to get digest of image %s of component %q: %w", img, name, err)
+		}
+		d.action.Infof("built image %s of component %q with digest %s", img, name, digest)
+		env["IMAGE_DIGEST_"+componentNameToEnvVar(name)] = digest
+	}
+	d.env = env
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/godo"
+	gha "github.com/sethvargo/go-githubactions"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateSpecWithBuild(t *testing.T) {
+	dir := t.TempDir()
+	specFilePath := filepath.Join(dir, "app.yaml")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "overlays"), 0755))
+	require.NoError(t, os.WriteFile(specFilePath, []byte(`name: app
+services:
+- name: web
+  image:
+    registry_type: DOCR
+    registry: my-registry
+    repository: web
+    tag: latest
+workers:
+- name: cache
+  image:
+    registry_type: DOCKER_HUB
+    repository: redis
+    tag: "7"
+`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "overlays", "ci.yaml"), []byte(`services:
+- name: web
+  build_context: ./web
+`), 0644))
+
+	var commands []string
+	d := &deployer{
+		action: gha.New(gha.WithWriter(io.Discard), gha.WithGetenv(func(k string) string {
+			if k == "GITHUB_SHA" {
+				return "abc123"
+			}
+			return ""
+		})),
+		httpClient: &http.Client{Transport: &fakeRegistry{manifests: map[string]string{
+			"registry.digitalocean.com/my-registry/web:abc123": `{}`,
+		}}},
+		run: func(_ context.Context, stdin io.Reader, name string, args ...string) error {
+			if stdin != nil {
+				input, _ := io.ReadAll(stdin)
+				args = append(args, "<", string(input))
+			}
+			commands = append(commands, name+" "+strings.Join(args, " "))
+			return nil
+		},
+		inputs: inputs{
+			token:           "do-token",
+			appSpecLocation: specFilePath,
+			environment:     "ci",
+			build:           true,
+			strictSpec:      true,
+		},
+	}
+	got, err := d.createSpec(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"docker login registry.digitalocean.com --username do-app-action --password-stdin < do-token",
+		"docker build --platform linux/amd64 --tag registry.digitalocean.com/my-registry/web:abc123 ./web",
+		"docker push registry.digitalocean.com/my-registry/web:abc123",
+	}, commands)
+	require.Equal(t, &godo.ImageSourceSpec{
+		RegistryType: godo.ImageSourceSpecRegistryType_DOCR,
+		Registry:     "my-registry",
+		Repository:   "web",
+		Digest:       "sha256:from-header", // The built image is deployed.
+	}, got.Services[0].Image)
+	require.Equal(t, "7", got.Workers[0].Image.Tag)
+	require.Equal(t, []imageReplacement{{
+		Component: "web",
+		From:      "registry.digitalocean.com/my-registry/web:latest",
+		To:        "registry.digitalocean.com/my-registry/web@sha256:from-header",
+	}}, d.imageReplacements)
+}
+
+func TestBuildContexts(t *testing.T) {
+	got, err := buildContexts([]byte(`services:
+- name: web
+  build_context: ./web
+- name: api
+workers:
+- name: worker
+  build_context: worker
+`))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"web": "./web", "worker": "worker"}, got)
+
+	_, err = buildContexts([]byte(`services:
+- name: web
+  build_context: 1
+`))
+	require.EqualError(t, err, `build_context of component "web" must be a path`)
+}
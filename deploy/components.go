@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/digitalocean/godo"
+)
+
+// selectComponents returns a copy of the live app spec where only the given
+// components are replaced by their definition in the given app spec. Components
+// the live app spec doesn't have yet are added. Everything else, including the
+// app's ingress and variables, is taken from the live app spec.
+func selectComponents(spec, live *godo.AppSpec, names []string) (*godo.AppSpec, error) {
+	bs, err := json.Marshal(live)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal live app spec: %w", err)
+	}
+	var selected *godo.AppSpec
+	if err := json.Unmarshal(bs, &selected); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal live app spec: %w", err)
+	}
+	if selected == nil {
+		return nil, fmt.Errorf("the app has no spec")
+	}
+
+	for _, name := range names {
+		var component godo.AppComponentSpec
+		_ = spec.ForEachAppComponentSpec(func(c godo.AppComponentSpec) error {
+			if c.GetName() == name {
+				component = c
+			}
+			return nil
+		})
+		if component == nil {
+			return nil, fmt.Errorf("component %q does not exist in the app spec", name)
+		}
+
+		selected.Services = putComponent(selected.Services, component)
+		selected.StaticSites = putComponent(selected.StaticSites, component)
+		selected.Workers = putComponent(selected.Workers, component)
+		selected.Jobs = putComponent(selected.Jobs, component)
+		selected.Functions = putComponent(selected.Functions, component)
+		selected.Databases = putComponent(selected.Databases, component)
+	}
+	return selected, nil
+}
+
+// putComponent replaces the component with the same name as the given component
+// in the given components, or appends it if there is none. If the given component
+// is of another type, the component with the same name is removed instead, since
+// the component's type changed.
+func putComponent[T godo.AppComponentSpec](components []T, component godo.AppComponentSpec) []T {
+	replacement, ok := component.(T)
+	var put []T
+	for _, c := range components {
+		if c.GetName() != component.GetName() {
+			put = append(put, c)
+		} else if ok {
+			put = append(put, replacement)
+			ok = false
+		}
+	}
+	if ok {
+		put = append(put, replacement)
+	}
+	return put
+}
+
+// sourceSpec is the source a component is deployed from.
+type sourceSpec struct {
+	GitHub    *godo.GitHubSourceSpec
+	GitLab    *godo.GitLabSourceSpec
+	Bitbucket *godo.BitbucketSourceSpec
+	Git       *godo.GitSourceSpec
+	Image     *godo.ImageSourceSpec
+}
+
+// sourceOf returns the source the given component is deployed from.
+func sourceOf(c godo.AppComponentSpec) sourceSpec {
+	var source sourceSpec
+	if bc, ok := c.(godo.AppBuildableComponentSpec); ok {
+		source.GitHub, source.GitLab, source.Bitbucket, source.Git = bc.GetGitHub(), bc.GetGitLab(), bc.GetBitbucket(), bc.GetGit()
+	}
+	if cc, ok := c.(godo.AppContainerComponentSpec); ok {
+		source.Image = cc.GetImage()
+	}
+	return source
+}
+
+// checkSourcesRefreshed fails if any of the given components of the app spec
+// wouldn't get the latest version of its source deployed when updating only the
+// sources of the given components. The API then only fetches sources that
+// changed, so a component deployed from the same Git branch keeps its commit and
+// one deployed from the same image tag keeps its image.
+func checkSourcesRefreshed(spec, live *godo.AppSpec, names []string) error {
+	sources := make(map[string]sourceSpec)
+	_ = live.ForEachAppComponentSpec(func(c godo.AppComponentSpec) error {
+		sources[c.GetName()] = sourceOf(c)
+		return nil
+	})
+
+	var err error
+	_ = spec.ForEachAppComponentSpec(func(c godo.AppComponentSpec) error {
+		if err != nil || !slices.Contains(names, c.GetName()) {
+			return nil
+		}
+		source := sourceOf(c)
+		if deployed, ok := sources[c.GetName()]; !ok || !reflect.DeepEqual(source, deployed) {
+			return nil
+		}
+		switch {
+		case source.GitHub != nil || source.GitLab != nil || source.Bitbucket != nil || source.Git != nil:
+			err = fmt.Errorf("component %q is deployed from the same Git branch as before, whose latest commit is only fetched when deploying all components", c.GetName())
+		case source.Image != nil && source.Image.GetDigest() == "":
+			err = fmt.Errorf("component %q is deployed from the same image tag %q as before, whose latest image is only fetched when deploying all components, unless resolve_digests is set", c.GetName(), source.Image.GetTag())
+		}
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/digitalocean/godo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectComponents(t *testing.T) {
+	live := &godo.AppSpec{
+		Name:   "app",
+		Region: "nyc",
+		Services: []*godo.AppServiceSpec{
+			{Name: "api", Image: &godo.ImageSourceSpec{Repository: "api", Tag: "v1"}},
+			{Name: "web", Image: &godo.ImageSourceSpec{Repository: "web", Tag: "v1"}},
+		},
+		Workers: []*godo.AppWorkerSpec{{Name: "queue", Image: &godo.ImageSourceSpec{Repository: "queue", Tag: "v1"}}},
+	}
+	spec := &godo.AppSpec{
+		Name: "app",
+		Services: []*godo.AppServiceSpec{
+			{Name: "api", Image: &godo.ImageSourceSpec{Repository: "api", Tag: "v2"}},
+			{Name: "web", Image: &godo.ImageSourceSpec{Repository: "web", Tag: "v2"}},
+			{Name: "queue", Image: &godo.ImageSourceSpec{Repository: "queue", Tag: "v2"}},
+		},
+		Jobs: []*godo.AppJobSpec{{Name: "migrate", Image: &godo.ImageSourceSpec{Repository: "migrate", Tag: "v2"}}},
+	}
+
+	got, err := selectComponents(spec, live, []string{"api", "queue", "migrate"})
+	require.NoError(t, err)
+	require.Equal(t, &godo.AppSpec{
+		Name:   "app",
+		Region: "nyc",
+		Services: []*godo.AppServiceSpec{
+			{Name: "api", Image: &godo.ImageSourceSpec{Repository: "api", Tag: "v2"}},
+			{Name: "web", Image: &godo.ImageSourceSpec{Repository: "web", Tag: "v1"}},
+			{Name: "queue", Image: &godo.ImageSourceSpec{Repository: "queue", Tag: "v2"}},
+		},
+		Jobs: []*godo.AppJobSpec{{Name: "migrate", Image: &godo.ImageSourceSpec{Repository: "migrate", Tag: "v2"}}},
+	}, got)
+	require.Equal(t, "v1", live.Services[0].Image.Tag, "live spec must not be modified")
+
+	_, err = selectComponents(spec, live, []string{"api", "missing"})
+	require.EqualError(t, err, `component "missing" does not exist in the app spec`)
+}
+
+func TestCheckSourcesRefreshed(t *testing.T) {
+	live := &godo.AppSpec{
+		Services: []*godo.AppServiceSpec{
+			{Name: "api", GitHub: &godo.GitHubSourceSpec{Repo: "org/repo", Branch: "main"}},
+			{Name: "web", Image: &godo.ImageSourceSpec{Repository: "web", Tag: "latest"}},
+			{Name: "docs", Image: &godo.ImageSourceSpec{Repository: "docs", Digest: "sha256:abcd"}},
+		},
+		Databases: []*godo.AppDatabaseSpec{{Name: "db"}},
+	}
+	spec := &godo.AppSpec{
+		Services: []*godo.AppServiceSpec{
+			{Name: "api", GitHub: &godo.GitHubSourceSpec{Repo: "org/repo", Branch: "main"}},
+			{Name: "web", Image: &godo.ImageSourceSpec{Repository: "web", Tag: "latest"}},
+			{Name: "docs", Image: &godo.ImageSourceSpec{Repository: "docs", Digest: "sha256:abcd"}},
+			{Name: "new", GitHub: &godo.GitHubSourceSpec{Repo: "org/repo", Branch: "main"}},
+		},
+		Databases: []*godo.AppDatabaseSpec{{Name: "db"}},
+	}
+
+	// Digests, new components and components without a source are fine.
+	require.NoError(t, checkSourcesRefreshed(spec, live, []string{"docs", "new", "db"}))
+	require.EqualError(t, checkSourcesRefreshed(spec, live, []string{"api"}),
+		`component "api" is deployed from the same Git branch as before, whose latest commit is only fetched when deploying all components`)
+	require.EqualError(t, checkSourcesRefreshed(spec, live, []string{"web"}),
+		`component "web" is deployed from the same image tag "latest" as before, whose latest image is only fetched when deploying all components, unless resolve_digests is set`)
+
+	// Changed sources are fetched.
+	spec.Services[0].GitHub = &godo.GitHubSourceSpec{Repo: "org/repo", Branch: "release"}
+	spec.Services[1].Image = &godo.ImageSourceSpec{Repository: "web", Tag: "v2"}
+	require.NoError(t, checkSourcesRefreshed(spec, live, []string{"api", "web"}))
+}
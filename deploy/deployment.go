@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+// deploymentClockSkew is the difference between the local clock and the API's
+// tolerated when checking when a deployment was created.
+const deploymentClockSkew = time.Minute
+
+// triggeredDeployment returns the ID of the deployment triggered by creating or
+// updating the given app at the given time. The app as returned by the API
+// carries that deployment as its pending deployment. If there is none, because
+// the update didn't change anything, a deployment is created explicitly.
+func (d *deployer) triggeredDeployment(ctx context.Context, app *godo.App, changedAt time.Time) (string, error) {
+	dep := app.GetPendingDeployment()
+	if dep.GetID() == "" {
+		d.action.Infof("the app change didn't trigger a deployment, creating one")
+		dep, _, err := d.apps.CreateDeployment(ctx, app.GetID())
+		if err != nil {
+			return "", fmt.Errorf("failed to create deployment: %w", err)
+		}
+		return dep.GetID(), nil
+	}
+
+	// Make sure the deployment is not one triggered by someone else in the meantime.
+	if createdAt := dep.GetCreatedAt(); !createdAt.IsZero() && createdAt.Before(changedAt.Add(-deploymentClockSkew)) {
+		return "", fmt.Errorf("pending deployment %s was created at %s, before the app was changed, by %s", dep.GetID(), createdAt.Format(time.RFC3339), describeCause(dep))
+	}
+	if cause := dep.GetCauseDetails(); cause != nil {
+		foreign := cause.GetType() != "" && cause.GetType() != godo.DeploymentCauseDetailsType_Manual && cause.GetType() != godo.DeploymentCauseDetailsType_Unknown
+		if action := cause.GetDigitalOceanUserAction().GetName(); action != "" && action != godo.DeploymentCauseDetailsDigitalOceanUserActionName_UpdateSpec && action != godo.DeploymentCauseDetailsDigitalOceanUserActionName_CreateDeployment {
+			foreign = true
+		}
+		if foreign {
+			return "", fmt.Errorf("pending deployment %s was not triggered by the app change but by %s", dep.GetID(), describeCause(dep))
+		}
+	}
+	return dep.GetID(), nil
+}
+
+// forceRebuild creates a deployment of the given app that rebuilds all components
+// without build caches and returns its ID. The API doesn't support rebuilding only
+// some components.
+func (d *deployer) forceRebuild(ctx context.Context, appID string) (string, error) {
+	d.action.Infof("forcing a rebuild of all components")
+	dep, _, err := d.apps.CreateDeployment(ctx, appID, &godo.DeploymentCreateRequest{ForceBuild: true})
+	if err != nil {
+		return "", fmt.Errorf("failed to create forced deployment: %w", err)
+	}
+	return dep.GetID(), nil
+}
+
+// supersededError returns an error describing which deployment superseded the
+// given deployment of the given app, and who triggered it.
+func (d *deployer) supersededError(ctx context.Context, appID string, dep *godo.Deployment) error {
+	ds, _, err := d.apps.ListDeployments(ctx, appID, &godo.ListOptions{PerPage: 20})
+	if err != nil {
+		return fmt.Errorf("deployment %s was superseded by another deployment", dep.GetID())
+	}
+
+	// Deployments are listed newest first, so the last newer one superseded ours.
+	var superseding *godo.Deployment
+	for _, other := range ds {
+		if other.GetID() == dep.GetID() {
+			break
+		}
+		if dep.GetCreatedAt().IsZero() || other.GetCreatedAt().After(dep.GetCreatedAt()) {
+			superseding = other
+		}
+	}
+	if superseding == nil {
+		return fmt.Errorf("deployment %s was superseded by another deployment", dep.GetID())
+	}
+	return fmt.Errorf("deployment %s was superseded by deployment %s, triggered by %s", dep.GetID(), superseding.GetID(), describeCause(superseding))
+}
+
+// describeCause describes who or what triggered the given deployment.
+func describeCause(dep *godo.Deployment) string {
+	cause := dep.GetCauseDetails()
+	switch {
+	case cause.GetGitPush() != nil:
+		push := cause.GetGitPush()
+		commit := push.GetCommitSHA()
+		if len(commit) > 7 {
+			commit = commit[:7]
+		}
+		desc := fmt.Sprintf("a push of commit %s", commit)
+		if push.GetUsername() != "" {
+			desc += " by " + push.GetUsername()
+		}
+		return desc
+	case cause.GetDOCRPush() != nil:
+		push := cause.GetDOCRPush()
+		return fmt.Sprintf("a push of image %s/%s:%s", push.GetRegistry(), push.GetRepository(), push.GetTag())
+	case cause.GetDigitalOceanUserAction() != nil:
+		action := cause.GetDigitalOceanUserAction()
+		desc := fmt.Sprintf("the action %s", action.GetName())
+		if user := action.GetUser(); user != nil {
+			if user.GetFullName() != "" {
+				desc += fmt.Sprintf(" of %s <%s>", user.GetFullName(), user.GetEmail())
+			} else {
+				desc += " of " + user.GetEmail()
+			}
+		}
+		return desc
+	case cause.GetAutoscaler() != nil:
+		return "the autoscaler"
+	case dep.GetCause() != "":
+		return fmt.Sprintf("%q", dep.GetCause())
+	}
+	return "an unknown cause"
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+	gha "github.com/sethvargo/go-githubactions"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTriggeredDeployment(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	d := &deployer{action: gha.New(gha.WithWriter(io.Discard))}
+
+	got, err := d.triggeredDeployment(ctx, &godo.App{PendingDeployment: &godo.Deployment{
+		ID:        "ours",
+		CreatedAt: now,
+		CauseDetails: &godo.DeploymentCauseDetails{
+			Type: godo.DeploymentCauseDetailsType_Manual,
+			DigitalOceanUserAction: &godo.DeploymentCauseDetailsDigitalOceanUserAction{
+				Name: godo.DeploymentCauseDetailsDigitalOceanUserActionName_UpdateSpec,
+			},
+		},
+	}}, now)
+	require.NoError(t, err)
+	require.Equal(t, "ours", got)
+
+	_, err = d.triggeredDeployment(ctx, &godo.App{PendingDeployment: &godo.Deployment{
+		ID:        "old",
+		CreatedAt: now.Add(-time.Hour),
+		Cause:     "manual",
+	}}, now)
+	require.EqualError(t, err, `pending deployment old was created at `+now.Add(-time.Hour).Format(time.RFC3339)+`, before the app was changed, by "manual"`)
+
+	_, err = d.triggeredDeployment(ctx, &godo.App{PendingDeployment: &godo.Deployment{
+		ID: "rollback",
+		CauseDetails: &godo.DeploymentCauseDetails{
+			DigitalOceanUserAction: &godo.DeploymentCauseDetailsDigitalOceanUserAction{
+				Name: godo.DeploymentCauseDetailsDigitalOceanUserActionName_RollbackApp,
+				User: &godo.DeploymentCauseDetailsDigitalOceanUser{FullName: "Jane Doe", Email: "jane@example.com"},
+			},
+		},
+	}}, now)
+	require.EqualError(t, err, "pending deployment rollback was not triggered by the app change but by the action ROLLBACK_APP of Jane Doe <jane@example.com>")
+
+	as := &mockedAppsService{}
+	as.On("CreateDeployment", ctx, "app-id", []*godo.DeploymentCreateRequest(nil)).Return(&godo.Deployment{ID: "created"}, &godo.Response{}, nil)
+	d.apps = as
+	got, err = d.triggeredDeployment(ctx, &godo.App{ID: "app-id"}, now)
+	require.NoError(t, err)
+	require.Equal(t, "created", got)
+}
+
+func TestSupersededError(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	ours := &godo.Deployment{ID: "ours", CreatedAt: now, Phase: godo.DeploymentPhase_Superseded}
+
+	as := &mockedAppsService{}
+	as.On("ListDeployments", ctx, "app-id", mock.Anything).Return([]*godo.Deployment{{
+		ID:        "newest",
+		CreatedAt: now.Add(2 * time.Minute),
+	}, {
+		ID:        "superseding",
+		CreatedAt: now.Add(time.Minute),
+		CauseDetails: &godo.DeploymentCauseDetails{
+			GitPush: &godo.DeploymentCauseDetailsGitPush{CommitSHA: "0123456789", Username: "someone"},
+		},
+	}, ours}, &godo.Response{}, nil)
+
+	d := &deployer{apps: as}
+	err := d.supersededError(ctx, "app-id", ours)
+	require.EqualError(t, err, "deployment ours was superseded by deployment superseding, triggered by a push of commit 0123456 by someone")
+}
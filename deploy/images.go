@@ -1,27 +1,74 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"sort"
 	"strings"
 
 	"github.com/digitalocean/godo"
+	"sigs.k8s.io/yaml"
 )
 
+// imageEnvPrefixes are the prefixes of the environment variables that replace
+// parts of a component's image, suffixed by the component's name.
+var imageEnvPrefixes = []string{"IMAGE_REGISTRY_", "IMAGE_REPOSITORY_", "IMAGE_DIGEST_", "IMAGE_TAG_"}
+
 // replaceImagesInSpec replaces the images in the given AppSpec with the ones defined in the environment.
-func replaceImagesInSpec(spec *godo.AppSpec) error {
+//
+// IMAGE_REGISTRY_<COMPONENT>, IMAGE_REPOSITORY_<COMPONENT>, IMAGE_DIGEST_<COMPONENT>
+// and IMAGE_TAG_<COMPONENT> replace the respective part of a component's image.
+// IMAGE_TAG is the tag of all other images from IMAGE_REPOSITORY. It's ignored
+// without IMAGE_REPOSITORY, since retagging third-party images like redis would
+// break them. It fails if a variable could refer to multiple components.
+func replaceImagesInSpec(spec *godo.AppSpec, getenv func(string) string) error {
+	// Different component names can map to the same variable, like my-web and my_web.
+	components := make(map[string][]string)
+	_ = godo.ForEachAppSpecComponent(spec, func(c godo.AppContainerComponentSpec) error {
+		if c.GetImage() != nil {
+			envName := componentNameToEnvVar(c.GetName())
+			components[envName] = append(components[envName], c.GetName())
+		}
+		return nil
+	})
+	for envName, names := range components {
+		if len(names) < 2 {
+			continue
+		}
+		for _, prefix := range imageEnvPrefixes {
+			if getenv(prefix+envName) != "" {
+				sort.Strings(names)
+				return fmt.Errorf("%s is ambiguous, it applies to components %s", prefix+envName, strings.Join(names, " and "))
+			}
+		}
+	}
+
+	defaultTag, defaultRepository := getenv("IMAGE_TAG"), getenv("IMAGE_REPOSITORY")
 	if err := godo.ForEachAppSpecComponent(spec, func(c godo.AppContainerComponentSpec) error {
 		image := c.GetImage()
 		if image == nil {
 			return nil
 		}
 
-		if digest := os.Getenv("IMAGE_DIGEST_" + componentNameToEnvVar(c.GetName())); digest != "" {
+		envName := componentNameToEnvVar(c.GetName())
+		if registry := getenv("IMAGE_REGISTRY_" + envName); registry != "" {
+			image.Registry = registry
+		}
+		if repository := getenv("IMAGE_REPOSITORY_" + envName); repository != "" {
+			image.Repository = repository
+		}
+		if digest := getenv("IMAGE_DIGEST_" + envName); digest != "" {
 			image.Tag = ""
 			image.Digest = digest
-		} else if tag := os.Getenv("IMAGE_TAG_" + componentNameToEnvVar(c.GetName())); tag != "" {
+		} else if tag := getenv("IMAGE_TAG_" + envName); tag != "" {
 			image.Digest = ""
 			image.Tag = tag
+		} else if defaultTag != "" && defaultRepository != "" && imageFromRepository(image, defaultRepository) {
+			image.Digest = ""
+			image.Tag = defaultTag
 		}
 		return nil
 	}); err != nil {
@@ -30,7 +77,198 @@ func replaceImagesInSpec(spec *godo.AppSpec) error {
 	return nil
 }
 
+// imageFromRepository returns whether the given image is from the given repository,
+// given either as just the repository or including the registry.
+func imageFromRepository(image *godo.ImageSourceSpec, repository string) bool {
+	return image.GetRepository() == repository || image.GetRegistry()+"/"+image.GetRepository() == repository
+}
+
+// imageReplacement is a replacement of a component's image.
+type imageReplacement struct {
+	Component string `json:"component"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+}
+
+// componentImages returns the references of the images of all components, keyed
+// by component name.
+func componentImages(spec *godo.AppSpec) map[string]string {
+	images := make(map[string]string)
+	_ = godo.ForEachAppSpecComponent(spec, func(c godo.AppContainerComponentSpec) error {
+		if c.GetImage() != nil {
+			images[c.GetName()] = imageReference(c.GetImage())
+		}
+		return nil
+	})
+	return images
+}
+
+// imageReplacements returns the images of the given app spec that differ from the
+// given previous images, in the order of the components.
+func imageReplacements(spec *godo.AppSpec, previous map[string]string) []imageReplacement {
+	replacements := []imageReplacement{}
+	_ = godo.ForEachAppSpecComponent(spec, func(c godo.AppContainerComponentSpec) error {
+		if c.GetImage() == nil {
+			return nil
+		}
+		if to := imageReference(c.GetImage()); to != previous[c.GetName()] {
+			replacements = append(replacements, imageReplacement{Component: c.GetName(), From: previous[c.GetName()], To: to})
+		}
+		return nil
+	})
+	return replacements
+}
+
 // componentNameToEnvVar converts a component name to an environment variable name.
 func componentNameToEnvVar(name string) string {
 	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
 }
+
+// imageOverride overrides parts of a component's image. Empty fields are left as is.
+type imageOverride struct {
+	RegistryType godo.ImageSourceSpecRegistryType `json:"registry_type,omitempty"`
+	Registry     string                           `json:"registry,omitempty"`
+	Repository   string                           `json:"repository,omitempty"`
+	Tag          string                           `json:"tag,omitempty"`
+	Digest       string                           `json:"digest,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Besides an object, an override can be
+// given as a plain tag or digest.
+func (o *imageOverride) UnmarshalJSON(data []byte) error {
+	var ref string
+	if err := json.Unmarshal(data, &ref); err == nil {
+		if strings.HasPrefix(ref, "sha256:") {
+			*o = imageOverride{Digest: ref}
+		} else {
+			*o = imageOverride{Tag: ref}
+		}
+		return nil
+	}
+
+	// Unknown fields would be silently ignored with a custom unmarshaler otherwise.
+	type plain imageOverride
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode((*plain)(o))
+}
+
+// parseImageOverrides parses a YAML or JSON map of component names to image overrides.
+func parseImageOverrides(s string) (map[string]*imageOverride, error) {
+	var overrides map[string]*imageOverride
+	if err := yaml.UnmarshalStrict([]byte(s), &overrides); err != nil {
+		return nil, err
+	}
+	for name, o := range overrides {
+		if o == nil {
+			return nil, fmt.Errorf("image of component %q is empty", name)
+		}
+		if o.Tag != "" && o.Digest != "" {
+			return nil, fmt.Errorf("image of component %q must not define both a tag and a digest", name)
+		}
+	}
+	return overrides, nil
+}
+
+// applyImageOverrides applies the given overrides to the images of the respective
+// components in the given AppSpec. It fails if a component doesn't exist or isn't
+// deployed from an image.
+func applyImageOverrides(spec *godo.AppSpec, overrides map[string]*imageOverride) error {
+	components := make(map[string]godo.AppComponentSpec)
+	_ = spec.ForEachAppComponentSpec(func(c godo.AppComponentSpec) error {
+		components[c.GetName()] = c
+		return nil
+	})
+
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		c, ok := components[name]
+		if !ok {
+			return fmt.Errorf("component %q does not exist", name)
+		}
+		cc, ok := c.(godo.AppContainerComponentSpec)
+		if !ok || cc.GetImage() == nil {
+			return fmt.Errorf("component %q is not deployed from an image", name)
+		}
+
+		image, o := cc.GetImage(), overrides[name]
+		if o.RegistryType != "" {
+			image.RegistryType = o.RegistryType
+		}
+		if o.Registry != "" {
+			image.Registry = o.Registry
+		}
+		if o.Repository != "" {
+			image.Repository = o.Repository
+		}
+		if o.Digest != "" {
+			image.Tag = ""
+			image.Digest = o.Digest
+		} else if o.Tag != "" {
+			image.Digest = ""
+			image.Tag = o.Tag
+		}
+	}
+	return nil
+}
+
+// resolveImageDigests pins the images deployed from a tag to the digest the tag
+// currently points to, so exactly that image is deployed. It returns the resolved
+// digests keyed by component name.
+func (d *deployer) resolveImageDigests(ctx context.Context, spec *godo.AppSpec) (map[string]string, error) {
+	registry := &registryClient{httpClient: d.httpClient}
+	digests := make(map[string]string)
+	if err := godo.ForEachAppSpecComponent(spec, func(c godo.AppContainerComponentSpec) error {
+		image := c.GetImage()
+		if image == nil || image.GetDigest() != "" {
+			return nil
+		}
+		img, err := d.registryImage(ctx, image)
+		if err != nil {
+			return fmt.Errorf("component %q: %w", c.GetName(), err)
+		}
+		digest, err := registry.manifestDigest(ctx, img)
+		if err != nil {
+			return fmt.Errorf("component %q: failed to resolve %s: %w", c.GetName(), img, err)
+		}
+		d.action.Infof("resolved image %s of component %q to digest %s", img, c.GetName(), digest)
+		image.Tag = ""
+		image.Digest = digest
+		digests[c.GetName()] = digest
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return digests, nil
+}
+
+// checkImagesExist checks that the images of all components exist in their
+// registries. All missing images are reported together.
+func (d *deployer) checkImagesExist(ctx context.Context, spec *godo.AppSpec) error {
+	registry := &registryClient{httpClient: d.httpClient}
+	var errs []error
+	_ = godo.ForEachAppSpecComponent(spec, func(c godo.AppContainerComponentSpec) error {
+		image := c.GetImage()
+		if image == nil {
+			return nil
+		}
+		img, err := d.registryImage(ctx, image)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("component %q: %w", c.GetName(), err))
+			return nil
+		}
+		if _, err := registry.manifestDigest(ctx, img); err != nil {
+			if errors.Is(err, errManifestNotFound) {
+				err = fmt.Errorf("image %s does not exist", img)
+			}
+			errs = append(errs, fmt.Errorf("component %q: %w", c.GetName(), err))
+		}
+		return nil
+	})
+	return errors.Join(errs...)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"os"
 	"testing"
 
 	"github.com/digitalocean/godo"
@@ -40,7 +41,7 @@ func TestReplaceImagesInSpec(t *testing.T) {
 	t.Setenv("IMAGE_TAG_WEB", "v1")
 	t.Setenv("IMAGE_DIGEST_FANCY_WORKER", "1234abcd")
 	t.Setenv("IMAGE_DIGEST_JOB", "1234abcd")
-	err := replaceImagesInSpec(spec)
+	err := replaceImagesInSpec(spec, os.Getenv)
 	require.NoError(t, err)
 
 	expected := &godo.AppSpec{
@@ -74,3 +75,179 @@ func TestReplaceImagesInSpec(t *testing.T) {
 
 	require.Equal(t, expected, spec)
 }
+
+func TestReplaceImagesInSpecRules(t *testing.T) {
+	newSpec := func() *godo.AppSpec {
+		return &godo.AppSpec{
+			Services: []*godo.AppServiceSpec{{
+				Name: "web",
+				Image: &godo.ImageSourceSpec{
+					RegistryType: godo.ImageSourceSpecRegistryType_Ghcr,
+					Registry:     "org",
+					Repository:   "app",
+					Tag:          "v1",
+				},
+			}, {
+				Name: "api",
+				Image: &godo.ImageSourceSpec{
+					RegistryType: godo.ImageSourceSpecRegistryType_Ghcr,
+					Registry:     "org",
+					Repository:   "app",
+					Tag:          "v1",
+				},
+			}},
+			Workers: []*godo.AppWorkerSpec{{
+				Name: "cache",
+				Image: &godo.ImageSourceSpec{
+					RegistryType: godo.ImageSourceSpecRegistryType_DockerHub,
+					Repository:   "redis",
+					Tag:          "7",
+				},
+			}},
+		}
+	}
+
+	t.Run("default tag for repository", func(t *testing.T) {
+		spec := newSpec()
+		env := map[string]string{
+			"IMAGE_TAG":        "v2",
+			"IMAGE_REPOSITORY": "org/app",
+			"IMAGE_TAG_API":    "v3",
+		}
+		previous := componentImages(spec)
+		require.NoError(t, replaceImagesInSpec(spec, func(k string) string { return env[k] }))
+		require.Equal(t, "v2", spec.Services[0].Image.Tag)
+		require.Equal(t, "v3", spec.Services[1].Image.Tag) // Component-specific tags take precedence.
+		require.Equal(t, "7", spec.Workers[0].Image.Tag)   // Other repositories are untouched.
+		require.Equal(t, []imageReplacement{
+			{Component: "web", From: "ghcr.io/org/app:v1", To: "ghcr.io/org/app:v2"},
+			{Component: "api", From: "ghcr.io/org/app:v1", To: "ghcr.io/org/app:v3"},
+		}, imageReplacements(spec, previous))
+	})
+
+	t.Run("default tag without repository", func(t *testing.T) {
+		spec := newSpec()
+		spec.Workers = append(spec.Workers, &godo.AppWorkerSpec{
+			Name: "db",
+			Image: &godo.ImageSourceSpec{
+				RegistryType: godo.ImageSourceSpecRegistryType_DockerHub,
+				Repository:   "postgres",
+				Tag:          "16",
+			},
+		})
+		env := map[string]string{"IMAGE_TAG": "v2"}
+		require.NoError(t, replaceImagesInSpec(spec, func(k string) string { return env[k] }))
+		// Third-party images must not be retagged.
+		require.Equal(t, "7", spec.Workers[0].Image.Tag)
+		require.Equal(t, "16", spec.Workers[1].Image.Tag)
+		require.Equal(t, "v1", spec.Services[0].Image.Tag)
+	})
+
+	t.Run("registry and repository", func(t *testing.T) {
+		spec := newSpec()
+		env := map[string]string{
+			"IMAGE_REGISTRY_CACHE":   "bitnami",
+			"IMAGE_REPOSITORY_CACHE": "valkey",
+			"IMAGE_TAG_CACHE":        "8",
+		}
+		require.NoError(t, replaceImagesInSpec(spec, func(k string) string { return env[k] }))
+		require.Equal(t, &godo.ImageSourceSpec{
+			RegistryType: godo.ImageSourceSpecRegistryType_DockerHub,
+			Registry:     "bitnami",
+			Repository:   "valkey",
+			Tag:          "8",
+		}, spec.Workers[0].Image)
+	})
+
+	t.Run("ambiguous", func(t *testing.T) {
+		spec := newSpec()
+		spec.Services[0].Name = "my-web"
+		spec.Services[1].Name = "my_web"
+		env := map[string]string{"IMAGE_TAG_MY_WEB": "v2"}
+		err := replaceImagesInSpec(spec, func(k string) string { return env[k] })
+		require.EqualError(t, err, "IMAGE_TAG_MY_WEB is ambiguous, it applies to components my-web and my_web")
+	})
+}
+
+func TestParseImageOverrides(t *testing.T) {
+	got, err := parseImageOverrides(`
+web: v1
+worker: sha256:abcd
+api:
+  registry: other
+  repository: api
+  tag: v2
+`)
+	require.NoError(t, err)
+	require.Equal(t, map[string]*imageOverride{
+		"web":    {Tag: "v1"},
+		"worker": {Digest: "sha256:abcd"},
+		"api":    {Registry: "other", Repository: "api", Tag: "v2"},
+	}, got)
+
+	got, err = parseImageOverrides(`{"web": "v1"}`)
+	require.NoError(t, err)
+	require.Equal(t, map[string]*imageOverride{"web": {Tag: "v1"}}, got)
+
+	got, err = parseImageOverrides("")
+	require.NoError(t, err)
+	require.Empty(t, got)
+
+	_, err = parseImageOverrides(`web: {tag: v1, digest: "sha256:abcd"}`)
+	require.EqualError(t, err, `image of component "web" must not define both a tag and a digest`)
+
+	_, err = parseImageOverrides(`web: {version: v1}`)
+	require.ErrorContains(t, err, `unknown field "version"`)
+}
+
+func TestApplyImageOverrides(t *testing.T) {
+	newSpec := func() *godo.AppSpec {
+		return &godo.AppSpec{
+			Name: "foo",
+			Services: []*godo.AppServiceSpec{{
+				Name: "web",
+				Image: &godo.ImageSourceSpec{
+					RegistryType: godo.ImageSourceSpecRegistryType_DOCR,
+					Repository:   "web",
+					Digest:       "sha256:1234",
+				},
+			}},
+			Workers: []*godo.AppWorkerSpec{{
+				Name: "worker",
+				Image: &godo.ImageSourceSpec{
+					RegistryType: godo.ImageSourceSpecRegistryType_DockerHub,
+					Registry:     "foo",
+					Repository:   "worker",
+					Tag:          "latest",
+				},
+			}},
+			Jobs: []*godo.AppJobSpec{{
+				Name: "job",
+				GitHub: &godo.GitHubSourceSpec{
+					Repo:   "foo/bar",
+					Branch: "main",
+				},
+			}},
+		}
+	}
+
+	spec := newSpec()
+	require.NoError(t, applyImageOverrides(spec, map[string]*imageOverride{
+		"web":    {Tag: "v1"},
+		"worker": {Registry: "bar", Repository: "other-worker", Digest: "sha256:abcd"},
+	}))
+	require.Equal(t, &godo.ImageSourceSpec{
+		RegistryType: godo.ImageSourceSpecRegistryType_DOCR,
+		Repository:   "web",
+		Tag:          "v1", // Tag was updated, digest was removed.
+	}, spec.Services[0].Image)
+	require.Equal(t, &godo.ImageSourceSpec{
+		RegistryType: godo.ImageSourceSpecRegistryType_DockerHub,
+		Registry:     "bar",
+		Repository:   "other-worker",
+		Digest:       "sha256:abcd",
+	}, spec.Workers[0].Image)
+
+	require.EqualError(t, applyImageOverrides(newSpec(), map[string]*imageOverride{"api": {Tag: "v1"}}), `component "api" does not exist`)
+	require.EqualError(t, applyImageOverrides(newSpec(), map[string]*imageOverride{"job": {Tag: "v1"}}), `component "job" is not deployed from an image`)
+}
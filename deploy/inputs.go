@@ -1,36 +1,144 @@
 package main
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/digitalocean/app_action/utils"
 	gha "github.com/sethvargo/go-githubactions"
 )
 
+// Ways to handle variables in the app spec that are not set.
+const (
+	unresolvedVariablesIgnore = "ignore"
+	unresolvedVariablesWarn   = "warn"
+	unresolvedVariablesFail   = "fail"
+)
+
 // inputs are the inputs for the action.
 type inputs struct {
-	token           string
-	appSpecLocation string
-	projectID       string
-	appName         string
-	printBuildLogs  bool
-	printDeployLogs bool
-	deployPRPreview bool
+	token string
+	// appSpecLocation is the app spec file to deploy. It's resolved from
+	// appSpecLocations if those resolve to a single file.
+	appSpecLocation  string
+	appSpecLocations []string
+	projectID        string
+	appName          string
+	printBuildLogs   bool
+	printDeployLogs  bool
+	deployPRPreview  bool
+	strictSpec       bool
+
+	unresolvedVariables string
+	templateSpec        bool
+	valuesFile          string
+	environment         string
+	secrets             []secretRef
+	images              map[string]*imageOverride
+	resolveDigests      bool
+	checkImages         bool
+	build               bool
+	waitOnly            bool
+	skipIfUnchanged     bool
+	forceRebuild        bool
+	components          []string
+	pollInterval        time.Duration
+
+	previewDomainTemplate string
+	previewDomainZone     string
+
+	manifest               string
+	maxParallelDeployments int
+	failFast               bool
 }
 
 // getInputs gets the inputs for the action.
 func getInputs(a *gha.Action) (inputs, error) {
 	var in inputs
+	var secrets []string
+	var images string
 	for _, err := range []error{
 		utils.InputAsString(a, "token", true, &in.token),
-		utils.InputAsString(a, "app_spec_location", false, &in.appSpecLocation),
+		utils.InputAsList(a, "app_spec_location", false, &in.appSpecLocations),
 		utils.InputAsString(a, "project_id", false, &in.projectID),
 		utils.InputAsString(a, "app_name", false, &in.appName),
 		utils.InputAsBool(a, "print_build_logs", true, &in.printBuildLogs),
 		utils.InputAsBool(a, "print_deploy_logs", true, &in.printDeployLogs),
 		utils.InputAsBool(a, "deploy_pr_preview", true, &in.deployPRPreview),
+		utils.InputAsBool(a, "strict_spec", false, &in.strictSpec),
+		utils.InputAsString(a, "unresolved_variables", false, &in.unresolvedVariables),
+		utils.InputAsBool(a, "template_spec", false, &in.templateSpec),
+		utils.InputAsString(a, "values_file", false, &in.valuesFile),
+		utils.InputAsString(a, "environment", false, &in.environment),
+		utils.InputAsList(a, "secrets", false, &secrets),
+		utils.InputAsString(a, "images", false, &images),
+		utils.InputAsBool(a, "resolve_digests", false, &in.resolveDigests),
+		utils.InputAsBool(a, "check_images", false, &in.checkImages),
+		utils.InputAsBool(a, "build", false, &in.build),
+		utils.InputAsBool(a, "wait_only", false, &in.waitOnly),
+		utils.InputAsBool(a, "skip_if_unchanged", false, &in.skipIfUnchanged),
+		utils.InputAsBool(a, "force_rebuild", false, &in.forceRebuild),
+		utils.InputAsList(a, "components", false, &in.components),
+		utils.InputAsDuration(a, "poll_interval", false, &in.pollInterval),
+		utils.InputAsString(a, "preview_domain_template", false, &in.previewDomainTemplate),
+		utils.InputAsString(a, "preview_domain_zone", false, &in.previewDomainZone),
+		utils.InputAsString(a, "manifest", false, &in.manifest),
+		utils.InputAsInt(a, "max_parallel_deployments", false, &in.maxParallelDeployments),
+		utils.InputAsBool(a, "fail_fast", false, &in.failFast),
 	} {
 		if err != nil {
 			return in, err
 		}
 	}
+
+	if in.valuesFile != "" && !in.templateSpec {
+		return in, fmt.Errorf("input %q requires %q to be set", "values_file", "template_spec")
+	}
+
+	if in.build && in.appName != "" {
+		return in, fmt.Errorf("input %q is not supported with %q", "build", "app_name")
+	}
+
+	if in.waitOnly && (in.deployPRPreview || in.build) {
+		return in, fmt.Errorf("input %q is not supported with %q or %q", "wait_only", "deploy_pr_preview", "build")
+	}
+
+	if in.waitOnly && (in.skipIfUnchanged || in.forceRebuild || len(in.components) > 0) {
+		return in, fmt.Errorf("input %q is not supported with %q, %q or %q", "wait_only", "skip_if_unchanged", "force_rebuild", "components")
+	}
+
+	if in.previewDomainTemplate != "" {
+		if !in.deployPRPreview {
+			return in, fmt.Errorf("input %q requires %q to be set", "preview_domain_template", "deploy_pr_preview")
+		}
+		if !strings.Contains(in.previewDomainTemplate, "{number}") {
+			return in, fmt.Errorf("input %q must contain {number}, otherwise all pull requests share one domain", "preview_domain_template")
+		}
+	}
+
+	if in.pollInterval < 0 {
+		return in, fmt.Errorf("input %q must not be negative", "poll_interval")
+	}
+
+	if strings.ContainsAny(in.environment, `/\`) || strings.HasPrefix(in.environment, ".") {
+		return in, fmt.Errorf("input %q must be a plain name", "environment")
+	}
+
+	var err error
+	if in.secrets, err = parseSecretRefs(secrets); err != nil {
+		return in, fmt.Errorf("invalid input %q: %w", "secrets", err)
+	}
+	if in.images, err = parseImageOverrides(images); err != nil {
+		return in, fmt.Errorf("invalid input %q: %w", "images", err)
+	}
+
+	switch in.unresolvedVariables {
+	case "":
+		in.unresolvedVariables = unresolvedVariablesIgnore
+	case unresolvedVariablesIgnore, unresolvedVariablesWarn, unresolvedVariablesFail:
+	default:
+		return in, fmt.Errorf("input %q must be one of %q, %q or %q", "unresolved_variables", unresolvedVariablesIgnore, unresolvedVariablesWarn, unresolvedVariablesFail)
+	}
 	return in, nil
 }
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	gha "github.com/sethvargo/go-githubactions"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetInputsPreviewDomain(t *testing.T) {
+	tests := []struct {
+		name     string
+		inputs   map[string]string
+		expected string
+	}{{
+		name:   "valid",
+		inputs: map[string]string{"deploy_pr_preview": "true", "preview_domain_template": "pr-{number}.example.com"},
+	}, {
+		name:     "without PR preview",
+		inputs:   map[string]string{"deploy_pr_preview": "false", "preview_domain_template": "pr-{number}.example.com"},
+		expected: `input "preview_domain_template" requires "deploy_pr_preview" to be set`,
+	}, {
+		name:     "without number",
+		inputs:   map[string]string{"deploy_pr_preview": "true", "preview_domain_template": "preview.example.com"},
+		expected: `input "preview_domain_template" must contain {number}, otherwise all pull requests share one domain`,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env := map[string]string{
+				"INPUT_TOKEN":             "token",
+				"INPUT_PRINT_BUILD_LOGS":  "false",
+				"INPUT_PRINT_DEPLOY_LOGS": "false",
+			}
+			for k, v := range test.inputs {
+				env["INPUT_"+strings.ToUpper(k)] = v
+			}
+			a := gha.New(gha.WithGetenv(func(k string) string { return env[k] }))
+			_, err := getInputs(a)
+			if test.expected == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, test.expected)
+			}
+		})
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/digitalocean/app_action/utils"
@@ -31,16 +33,62 @@ func main() {
 	do.UserAgent = "do-app-action-deploy"
 	d := &deployer{
 		action:     a,
-		apps:       do.Apps,
+		apps:       utils.NewRetryingAppsService(do.Apps, a.Debugf),
+		docr:       do.Registry,
 		httpClient: http.DefaultClient,
+		run:        runCommand,
 		inputs:     in,
 	}
 
+	if in.manifest != "" {
+		if in.deployPRPreview {
+			a.Fatalf("deploy_pr_preview is not supported with a manifest")
+		}
+		m, err := readManifest(in.manifest)
+		if err != nil {
+			a.Fatalf("failed to read manifest: %v", err)
+		}
+		deployments, err := m.deployments()
+		if err != nil {
+			a.Fatalf("invalid manifest: %v", err)
+		}
+		deployAll(ctx, d, deployments)
+		return
+	}
+
+	if in.appName == "" {
+		locations, err := specLocations(in.appSpecLocations)
+		if err != nil {
+			a.Fatalf("failed to resolve app spec locations: %v", err)
+		}
+		if len(locations) > 1 {
+			if in.deployPRPreview {
+				a.Fatalf("deploy_pr_preview is not supported with multiple app specs")
+			}
+			deployAll(ctx, d, deploymentsFromLocations(locations))
+			return
+		}
+		d.inputs.appSpecLocation = locations[0]
+	}
+
 	spec, err := d.createSpec(ctx)
 	if err != nil {
-		a.Fatalf("failed to create spec: %v", err)
+		name := in.appName
+		if name == "" {
+			name = d.inputs.appSpecLocation
+		}
+		utils.AddStepSummary(a, failureSummary(name, err))
+		annotateSpecProblems(a, err)
+		specErrorAction(a, err).Fatalf("failed to create spec: %v", err)
+	}
+	if !in.waitOnly {
+		if err := d.prepareSpec(ctx, spec); err != nil {
+			utils.AddStepSummary(a, failureSummary(spec.GetName(), err))
+			a.Fatalf("failed to prepare spec: %v", err)
+		}
 	}
 
+	var previewDomain string
 	if in.deployPRPreview {
 		ghCtx, err := a.Context()
 		if err != nil {
@@ -51,29 +99,85 @@ func main() {
 		if err := utils.SanitizeSpecForPullRequestPreview(spec, ghCtx); err != nil {
 			a.Fatalf("failed to sanitize spec for PR preview: %v", err)
 		}
+
+		// Give the preview a stable hostname, if configured.
+		if in.previewDomainTemplate != "" {
+			previewDomain, err = utils.PreviewDomainFromTemplate(in.previewDomainTemplate, ghCtx)
+			if err != nil {
+				a.Fatalf("failed to generate preview domain: %v", err)
+			}
+			utils.SetPreviewDomain(spec, previewDomain, in.previewDomainZone)
+		}
 	}
 
-	app, err := d.deploy(ctx, spec)
-	if app != nil {
-		// Surface a JSON representation of the app regardless of success or failure.
-		appJSON, err := json.Marshal(app)
-		if err != nil {
-			a.Errorf("failed to marshal app: %v", err)
+	var res *deployResult
+	if in.waitOnly {
+		res, err = d.waitForPushDeployment(ctx, spec.GetName())
+	} else {
+		res, err = d.deploy(ctx, spec)
+	}
+	if res != nil {
+		// Surface the results regardless of success or failure.
+		if err := res.setOutputs(a); err != nil {
+			a.Errorf("failed to set outputs: %v", err)
 		}
-		a.SetOutput("app", string(appJSON))
+		utils.AddStepSummary(a, res.summary())
+	} else if err != nil {
+		utils.AddStepSummary(a, failureSummary(spec.GetName(), err))
 	}
 	if err != nil {
-		a.Fatalf("failed to deploy: %v", err)
+		specErrorAction(a, err).Fatalf("failed to deploy: %v", err)
 	}
+	app := res.App
 	a.Infof("App is now live under URL: %s", app.GetLiveURL())
+
+	if previewDomain != "" {
+		a.Infof("wait for domain %q to become active", previewDomain)
+		if _, err := d.waitForDomainActive(ctx, app.GetID(), previewDomain); err != nil {
+			a.Fatalf("failed to wait for preview domain: %v", err)
+		}
+		previewURL := "https://" + previewDomain
+		a.SetOutput("preview_url", previewURL)
+		a.Infof("Preview is now live under URL: %s", previewURL)
+	}
+}
+
+// deployAll deploys all given apps and surfaces the results.
+func deployAll(ctx context.Context, d *deployer, deployments []*appDeployment) {
+	a := d.action
+
+	results, err := d.deployMany(ctx, deployments)
+	resultsJSON, jsonErr := json.Marshal(resultsByName(results))
+	if jsonErr != nil {
+		a.Errorf("failed to marshal apps: %v", jsonErr)
+	}
+	a.SetOutput("apps", string(resultsJSON))
+	utils.AddStepSummary(a, manySummary(results))
+	if err != nil {
+		a.Fatalf("failed to deploy: %v", err)
+	}
 }
 
 // deployer is responsible for deploying the app.
 type deployer struct {
 	action     *gha.Action
 	apps       godo.AppsService
+	docr       godo.RegistryService
 	httpClient *http.Client
+	run        commandRunner
 	inputs     inputs
+
+	// env are variables available to the app spec in addition to the environment.
+	env map[string]string
+	// specSource is the rendered app spec read from the filesystem, if any. It's
+	// used to point errors at their position in the app spec.
+	specSource []byte
+	// specFile is the file specSource corresponds to. It's empty if specSource
+	// doesn't correspond to a single file, for example because an overlay was
+	// merged into it.
+	specFile string
+	// imageReplacements are the images createSpec replaced.
+	imageReplacements []imageReplacement
 }
 
 func (d *deployer) createSpec(ctx context.Context) (*godo.AppSpec, error) {
@@ -89,53 +193,236 @@ func (d *deployer) createSpec(ctx context.Context) (*godo.AppSpec, error) {
 		}
 		spec = app.Spec
 	} else {
-		appSpec, err := os.ReadFile(d.inputs.appSpecLocation)
+		appSpec, err := d.readSpecSource(d.inputs.appSpecLocation)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get app spec content: %w", err)
+			return nil, err
 		}
-		appSpecExpanded := utils.ExpandEnvRetainingBindables(string(appSpec))
-		if err := yaml.Unmarshal([]byte(appSpecExpanded), &spec); err != nil {
-			return nil, fmt.Errorf("failed to parse app spec: %w", err)
+		d.specSource = appSpec
+		d.specFile = d.inputs.appSpecLocation
+		if d.inputs.templateSpec {
+			// Positions in the rendered spec don't correspond to the template.
+			d.specFile = ""
+		}
+		if d.inputs.environment != "" {
+			overlayLocation := filepath.Join(filepath.Dir(d.inputs.appSpecLocation), "overlays", d.inputs.environment+".yaml")
+			overlay, err := d.readSpecSource(overlayLocation)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read overlay for environment %q: %w", d.inputs.environment, err)
+			}
+			d.specSource, err = mergeSpecOverlay(appSpec, overlay)
+			if err != nil {
+				return nil, fmt.Errorf("failed to apply overlay %s: %w", overlayLocation, err)
+			}
+			// Positions in the merged spec don't correspond to either file.
+			d.specFile = ""
+		}
+		if err := yaml.Unmarshal(d.specSource, &spec); err != nil {
+			return nil, fmt.Errorf("failed to parse app spec: %w", d.locateSpecError(err))
+		}
+		if d.inputs.strictSpec {
+			if err := d.validateSpecStrictly(spec); err != nil {
+				return nil, fmt.Errorf("invalid app spec: %w", err)
+			}
+		}
+		if d.inputs.build {
+			if err := d.buildImages(ctx, spec); err != nil {
+				return nil, fmt.Errorf("failed to build images: %w", err)
+			}
 		}
 	}
 
-	if err := replaceImagesInSpec(spec); err != nil {
+	previousImages := componentImages(spec)
+	if err := replaceImagesInSpec(spec, d.getenv); err != nil {
 		return nil, fmt.Errorf("failed to replace images in spec: %w", err)
 	}
+	if err := applyImageOverrides(spec, d.inputs.images); err != nil {
+		return nil, fmt.Errorf("failed to apply images: %w", err)
+	}
+	d.imageReplacements = imageReplacements(spec, previousImages)
 	return spec, nil
 }
 
+// prepareSpec prepares the given app spec for deployment. Secrets are injected
+// and masked, image replacements are reported and images are resolved to
+// digests and checked for existence, if configured.
+func (d *deployer) prepareSpec(ctx context.Context, spec *godo.AppSpec) error {
+	if err := d.injectSecrets(spec); err != nil {
+		return fmt.Errorf("failed to inject secrets: %w", err)
+	}
+	maskSecrets(d.action, spec)
+
+	for _, r := range d.imageReplacements {
+		d.action.Infof("replaced image of component %q: %s -> %s", r.Component, r.From, r.To)
+	}
+	replacementsJSON, err := json.Marshal(d.imageReplacements)
+	if err != nil {
+		return fmt.Errorf("failed to marshal image replacements: %w", err)
+	}
+	d.action.SetOutput("replaced_images", string(replacementsJSON))
+
+	if d.inputs.resolveDigests {
+		digests, err := d.resolveImageDigests(ctx, spec)
+		if err != nil {
+			return fmt.Errorf("failed to resolve image digests: %w", err)
+		}
+		digestsJSON, err := json.Marshal(digests)
+		if err != nil {
+			return fmt.Errorf("failed to marshal image digests: %w", err)
+		}
+		d.action.SetOutput("image_digests", string(digestsJSON))
+	}
+	if d.inputs.checkImages {
+		if err := d.checkImagesExist(ctx, spec); err != nil {
+			return fmt.Errorf("missing images:\n%w", err)
+		}
+	}
+	return nil
+}
+
+// readSpecSource reads the app spec at the given location, renders it if it's a
+// template and expands the environment variables it references.
+func (d *deployer) readSpecSource(location string) ([]byte, error) {
+	appSpec, err := os.ReadFile(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get app spec content: %w", err)
+	}
+	if d.inputs.templateSpec {
+		appSpec, err = d.renderSpecTemplate(location, appSpec)
+		if err != nil {
+			return nil, err
+		}
+	}
+	appSpecExpanded, unresolved := utils.ExpandRetainingBindables(string(appSpec), d.getenv)
+	if err := d.checkUnresolvedVariables(unresolved); err != nil {
+		return nil, err
+	}
+	return []byte(appSpecExpanded), nil
+}
+
+// getenv looks up the given variable in the deployer's variables first and falls
+// back to the environment.
+func (d *deployer) getenv(name string) string {
+	if value, ok := d.env[name]; ok {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+// checkUnresolvedVariables handles the variables that could not be resolved while
+// expanding the app spec. Required variables always cause an error, all other
+// variables are handled as configured.
+func (d *deployer) checkUnresolvedVariables(unresolved []utils.UnresolvedVariable) error {
+	var missing []string
+	for _, v := range unresolved {
+		if v.Required {
+			msg := v.Message
+			if msg == "" {
+				msg = "variable is required"
+			}
+			missing = append(missing, fmt.Sprintf("%s: %s", v.Name, msg))
+			continue
+		}
+
+		switch d.inputs.unresolvedVariables {
+		case unresolvedVariablesWarn:
+			d.action.Warningf("variable %q is referenced in the app spec but not set, it expanded to an empty string", v.Name)
+		case unresolvedVariablesFail:
+			missing = append(missing, fmt.Sprintf("%s: variable is not set", v.Name))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("app spec references unresolved variables:\n- %s", strings.Join(missing, "\n- "))
+	}
+	return nil
+}
+
 // deploy deploys the app and waits for it to be live.
-func (d *deployer) deploy(ctx context.Context, spec *godo.AppSpec) (*godo.App, error) {
+func (d *deployer) deploy(ctx context.Context, spec *godo.AppSpec) (*deployResult, error) {
 	// Either create or update the app.
 	app, err := utils.FindAppByName(ctx, d.apps, spec.GetName())
 	if err != nil {
 		return nil, fmt.Errorf("failed to get app: %w", err)
 	}
-	if app == nil {
+	created := app == nil
+	if len(d.inputs.components) > 0 {
+		if created {
+			return nil, fmt.Errorf("app %q does not exist yet, so its components can't be deployed selectively", spec.GetName())
+		}
+		if err := checkSourcesRefreshed(spec, app.GetSpec(), d.inputs.components); err != nil {
+			return nil, err
+		}
+		if spec, err = selectComponents(spec, app.GetSpec(), d.inputs.components); err != nil {
+			return nil, err
+		}
+		// The app-wide variables and unselected components come from the existing
+		// app, so inject the secrets into them again.
+		if err := d.injectSecrets(spec); err != nil {
+			return nil, fmt.Errorf("failed to inject secrets: %w", err)
+		}
+		d.action.Infof("deploying only components %s of app %q", strings.Join(d.inputs.components, ", "), spec.GetName())
+	}
+	// Deployments created before this point can't be the one we trigger.
+	changedAt := time.Now()
+	if created {
 		d.action.Infof("app %q does not exist yet, creating...", spec.Name)
 		app, _, err = d.apps.Create(ctx, &godo.AppCreateRequest{Spec: spec, ProjectID: d.inputs.projectID})
 		if err != nil {
-			return nil, fmt.Errorf("failed to create app: %w", err)
+			return nil, fmt.Errorf("failed to create app: %w", d.locateSpecError(err))
 		}
 	} else {
-		d.action.Infof("app %q already exists, updating...", spec.Name)
-		app, _, err = d.apps.Update(ctx, app.GetID(), &godo.AppUpdateRequest{Spec: spec, UpdateAllSourceVersions: true})
-		if err != nil {
-			return nil, fmt.Errorf("failed to update app: %w", err)
+		unchanged := false
+		if d.inputs.skipIfUnchanged {
+			var reason string
+			unchanged, reason, err = d.appUnchanged(spec, app)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compare app spec: %w", err)
+			}
+			switch {
+			case unchanged && d.inputs.forceRebuild:
+				d.action.Infof("app %q is unchanged, only forcing a rebuild", spec.Name)
+			case unchanged:
+				d.action.Infof("app %q is unchanged, skipping deployment", spec.Name)
+				return &deployResult{App: app, Deployment: app.GetActiveDeployment(), Skipped: true}, nil
+			default:
+				d.action.Infof("app %q changed: %s", spec.Name, reason)
+			}
+		}
+		if !unchanged {
+			d.action.Infof("app %q already exists, updating...", spec.Name)
+			if carried := carryOverSecrets(spec, app.GetSpec()); len(carried) > 0 {
+				d.action.Infof("carrying over encrypted secrets from the existing app: %s", strings.Join(carried, ", "))
+			}
+			// With selected components, the others keep their source versions.
+			// The API still fetches the sources of the selected components, since
+			// checkSourcesRefreshed made sure they changed.
+			app, _, err = d.apps.Update(ctx, app.GetID(), &godo.AppUpdateRequest{Spec: spec, UpdateAllSourceVersions: len(d.inputs.components) == 0})
+			if err != nil {
+				return nil, fmt.Errorf("failed to update app: %w", d.locateSpecError(err))
+			}
 		}
 	}
 
-	ds, _, err := d.apps.ListDeployments(ctx, app.GetID(), &godo.ListOptions{PerPage: 1})
-	if err != nil {
-		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	var deploymentID string
+	if d.inputs.forceRebuild && !created {
+		// Supersedes the deployment triggered by the update, if any, which
+		// cancels it. The API has no way to update the app without deploying.
+		if dep := app.GetPendingDeployment(); dep.GetID() != "" {
+			d.action.Infof("superseding deployment %s triggered by the update", dep.GetID())
+		}
+		deploymentID, err = d.forceRebuild(ctx, app.GetID())
+	} else {
+		deploymentID, err = d.triggeredDeployment(ctx, app, changedAt)
 	}
-	if len(ds) == 0 {
-		return nil, fmt.Errorf("expected a deployment right after creating/updating the app, but got none")
+	if err != nil {
+		return nil, err
 	}
-	// The latest deployment is the deployment we just created.
-	deploymentID := ds[0].GetID()
 
+	return d.awaitDeployment(ctx, app, deploymentID, created)
+}
+
+// awaitDeployment waits for the given deployment of the given app to finish and
+// collects its results.
+func (d *deployer) awaitDeployment(ctx context.Context, app *godo.App, deploymentID string, created bool) (*deployResult, error) {
 	d.action.Infof("wait for deployment to finish")
 	dep, err := d.waitForDeploymentTerminal(ctx, app.ID, deploymentID)
 	if err != nil {
@@ -176,7 +463,17 @@ func (d *deployer) deploy(ctx context.Context, spec *godo.AppSpec) (*godo.App, e
 		if err != nil {
 			return nil, fmt.Errorf("failed to get app after it failed: %w", err)
 		}
-		return app, fmt.Errorf("deployment failed in phase %q", dep.Phase)
+		res := &deployResult{
+			App:        app,
+			Deployment: dep,
+			Created:    created,
+			BuildLogs:  buildLogs,
+			DeployLogs: deployLogs,
+		}
+		if dep.GetPhase() == godo.DeploymentPhase_Superseded {
+			return res, d.supersededError(ctx, app.GetID(), dep)
+		}
+		return res, fmt.Errorf("deployment failed in phase %q", dep.Phase)
 	}
 
 	app, err = d.waitForAppLiveURL(ctx, app.ID)
@@ -184,24 +481,28 @@ func (d *deployer) deploy(ctx context.Context, spec *godo.AppSpec) (*godo.App, e
 		return nil, fmt.Errorf("failed to wait for app to have a live URL: %w", err)
 	}
 
-	return app, nil
+	return &deployResult{
+		App:        app,
+		Deployment: dep,
+		Created:    created,
+		BuildLogs:  buildLogs,
+		DeployLogs: deployLogs,
+	}, nil
 }
 
 // waitForDeploymentTerminal waits for the given deployment to be in a terminal state.
 func (d *deployer) waitForDeploymentTerminal(ctx context.Context, appID, deploymentID string) (*godo.Deployment, error) {
-	t := time.NewTicker(2 * time.Second)
-	defer t.Stop()
+	p := d.newPoller()
 
-	var dep *godo.Deployment
 	var currentPhase godo.DeploymentPhase
 	for {
-		var err error
-		dep, _, err = d.apps.GetDeployment(ctx, appID, deploymentID)
+		dep, resp, err := d.apps.GetDeployment(ctx, appID, deploymentID)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get deployment: %w", err)
 		}
 
-		if currentPhase != dep.GetPhase() {
+		changed := currentPhase != dep.GetPhase()
+		if changed {
 			d.action.Infof("deployment is in phase: %s", dep.GetPhase())
 			currentPhase = dep.GetPhase()
 		}
@@ -210,10 +511,8 @@ func (d *deployer) waitForDeploymentTerminal(ctx context.Context, appID, deploym
 			return dep, nil
 		}
 
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		case <-t.C:
+		if err := p.wait(ctx, resp, changed); err != nil {
+			return nil, err
 		}
 	}
 }
@@ -229,13 +528,10 @@ func isInTerminalPhase(d *godo.Deployment) bool {
 
 // waitForAppLiveURL waits for the given app to have a non-empty live URL.
 func (d *deployer) waitForAppLiveURL(ctx context.Context, appID string) (*godo.App, error) {
-	t := time.NewTicker(2 * time.Second)
-	defer t.Stop()
+	p := d.newPoller()
 
-	var a *godo.App
 	for {
-		var err error
-		a, _, err = d.apps.Get(ctx, appID)
+		a, resp, err := d.apps.Get(ctx, appID)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get deployment: %w", err)
 		}
@@ -244,10 +540,55 @@ func (d *deployer) waitForAppLiveURL(ctx context.Context, appID string) (*godo.A
 			return a, nil
 		}
 
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		case <-t.C:
+		if err := p.wait(ctx, resp, false); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// domainAppearTimeout is how long waitForDomainActive waits for the domain to
+// show up in the app at all.
+var domainAppearTimeout = 5 * time.Minute
+
+// waitForDomainActive waits for the given domain of the given app to be active, which
+// includes its certificate being issued.
+func (d *deployer) waitForDomainActive(ctx context.Context, appID, domain string) (*godo.App, error) {
+	p := d.newPoller()
+	start := time.Now()
+
+	var currentPhase godo.AppDomainPhase
+	for {
+		a, resp, err := d.apps.Get(ctx, appID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get app: %w", err)
+		}
+
+		changed, found := false, false
+		for _, dom := range a.Domains {
+			if dom.GetSpec().GetDomain() != domain {
+				continue
+			}
+			found = true
+
+			if currentPhase != dom.GetPhase() {
+				changed = true
+				d.action.Infof("domain is in phase: %s", dom.GetPhase())
+				currentPhase = dom.GetPhase()
+			}
+
+			switch dom.GetPhase() {
+			case godo.AppJobSpecKindPHASE_Active:
+				return a, nil
+			case godo.AppJobSpecKindPHASE_Error:
+				return a, fmt.Errorf("domain %q failed to be configured", domain)
+			}
+		}
+		if !found && time.Since(start) > domainAppearTimeout {
+			return a, fmt.Errorf("domain %q did not show up in the app within %s", domain, domainAppearTimeout)
+		}
+
+		if err := p.wait(ctx, resp, changed); err != nil {
+			return nil, err
 		}
 	}
 }
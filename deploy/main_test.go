@@ -7,7 +7,9 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/digitalocean/godo"
 	gha "github.com/sethvargo/go-githubactions"
@@ -98,6 +100,56 @@ func TestCreateSpecFromFile(t *testing.T) {
 	require.Equal(t, expected, got)
 }
 
+func TestCreateSpecUnresolvedVariables(t *testing.T) {
+	tests := []struct {
+		name         string
+		spec         string
+		mode         string
+		expectedLogs string
+		err          string
+	}{{
+		name: "ignore",
+		spec: "name: ${APP_NAME}-${SUFFIX}",
+		mode: unresolvedVariablesIgnore,
+	}, {
+		name:         "warn",
+		spec:         "name: ${APP_NAME}-${SUFFIX}",
+		mode:         unresolvedVariablesWarn,
+		expectedLogs: "::warning::variable \"SUFFIX\" is referenced in the app spec but not set, it expanded to an empty string\n",
+	}, {
+		name: "fail",
+		spec: "name: ${APP_NAME}-${SUFFIX}\nservices:\n- name: ${COMPONENT:-web}\n  envs:\n  - key: URL\n    value: ${web.PRIVATE_URL}",
+		mode: unresolvedVariablesFail,
+		err:  "app spec references unresolved variables:\n- SUFFIX: variable is not set",
+	}, {
+		name: "required",
+		spec: "name: ${APP_NAME}-${SUFFIX:?must be set to the environment}",
+		mode: unresolvedVariablesIgnore,
+		err:  "app spec references unresolved variables:\n- SUFFIX: must be set to the environment",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			specFilePath := t.TempDir() + "/spec.yaml"
+			require.NoError(t, os.WriteFile(specFilePath, []byte(test.spec), 0644))
+			t.Setenv("APP_NAME", "foo")
+
+			var actionLogs bytes.Buffer
+			d := &deployer{
+				action: gha.New(gha.WithWriter(&actionLogs)),
+				inputs: inputs{appSpecLocation: specFilePath, unresolvedVariables: test.mode},
+			}
+			_, err := d.createSpec(context.Background())
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, test.expectedLogs, actionLogs.String())
+		})
+	}
+}
+
 func TestCreateSpecFromExistingApp(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -194,16 +246,14 @@ func TestDeploy(t *testing.T) {
 		inputs         inputs
 		expectedLogs   []byte
 		expectedOutput []byte
+		expectedResult *deployResult
 		err            bool
 	}{{
 		name: "success",
 		appService: func() *mockedAppsService {
 			as := &mockedAppsService{}
 			as.On("List", ctx, mock.Anything).Return([]*godo.App{}, &godo.Response{}, nil)
-			as.On("Create", ctx, mock.Anything).Return(&godo.App{ID: appID}, &godo.Response{}, nil)
-			as.On("ListDeployments", ctx, appID, mock.Anything).Return([]*godo.Deployment{{
-				ID: deploymentID,
-			}}, &godo.Response{}, nil)
+			as.On("Create", ctx, mock.Anything).Return(&godo.App{ID: appID, PendingDeployment: &godo.Deployment{ID: deploymentID}}, &godo.Response{}, nil)
 			as.On("GetDeployment", ctx, appID, deploymentID).Return(&godo.Deployment{
 				Phase: godo.DeploymentPhase_Active,
 			}, &godo.Response{}, nil)
@@ -230,6 +280,13 @@ func TestDeploy(t *testing.T) {
 			printBuildLogs:  true,
 			printDeployLogs: true,
 		},
+		expectedResult: &deployResult{
+			App:        &godo.App{ID: appID, LiveURL: "https://example.com"},
+			Deployment: &godo.Deployment{Phase: godo.DeploymentPhase_Active},
+			Created:    true,
+			BuildLogs:  []byte("build log"),
+			DeployLogs: []byte("deploy log"),
+		},
 		expectedLogs: []byte(`app "foo" does not exist yet, creating...
 wait for deployment to finish
 deployment is in phase: ACTIVE
@@ -252,10 +309,7 @@ _GitHubActionsFileCommandDelimeter_
 		appService: func() *mockedAppsService {
 			as := &mockedAppsService{}
 			as.On("List", ctx, mock.Anything).Return([]*godo.App{{ID: appID, Spec: spec}}, &godo.Response{}, nil)
-			as.On("Update", ctx, appID, mock.Anything).Return(&godo.App{ID: appID}, &godo.Response{}, nil)
-			as.On("ListDeployments", ctx, appID, mock.Anything).Return([]*godo.Deployment{{
-				ID: deploymentID,
-			}}, &godo.Response{}, nil)
+			as.On("Update", ctx, appID, &godo.AppUpdateRequest{Spec: spec, UpdateAllSourceVersions: true}).Return(&godo.App{ID: appID, PendingDeployment: &godo.Deployment{ID: deploymentID}}, &godo.Response{}, nil)
 			as.On("GetDeployment", ctx, appID, deploymentID).Return(&godo.Deployment{
 				Phase: godo.DeploymentPhase_Active,
 			}, &godo.Response{}, nil)
@@ -282,6 +336,13 @@ _GitHubActionsFileCommandDelimeter_
 wait for deployment to finish
 deployment is in phase: ACTIVE
 `),
+		expectedResult: &deployResult{
+			App:        &godo.App{ID: appID, LiveURL: "https://example.com"},
+			Deployment: &godo.Deployment{Phase: godo.DeploymentPhase_Active},
+			Created:    false,
+			BuildLogs:  []byte("build log"),
+			DeployLogs: []byte("deploy log"),
+		},
 		expectedOutput: []byte(`build_logs<<_GitHubActionsFileCommandDelimeter_
 build log
 _GitHubActionsFileCommandDelimeter_
@@ -289,15 +350,62 @@ deploy_logs<<_GitHubActionsFileCommandDelimeter_
 deploy log
 _GitHubActionsFileCommandDelimeter_
 `),
+	}, {
+		name: "forces rebuild of unchanged app",
+		appService: func() *mockedAppsService {
+			as := &mockedAppsService{}
+			as.On("List", ctx, mock.Anything).Return([]*godo.App{{ID: appID, Spec: spec, ActiveDeployment: &godo.Deployment{ID: "active-id"}}}, &godo.Response{}, nil)
+			as.On("CreateDeployment", ctx, appID, []*godo.DeploymentCreateRequest{{ForceBuild: true}}).Return(&godo.Deployment{ID: deploymentID}, &godo.Response{}, nil)
+			as.On("GetDeployment", ctx, appID, deploymentID).Return(&godo.Deployment{
+				Phase: godo.DeploymentPhase_Active,
+			}, &godo.Response{}, nil)
+			as.On("GetLogs", ctx, appID, deploymentID, "", godo.AppLogTypeBuild, true, -1).Return(&godo.AppLogs{}, &godo.Response{}, nil)
+			as.On("GetLogs", ctx, appID, deploymentID, "", godo.AppLogTypeDeploy, true, -1).Return(&godo.AppLogs{}, &godo.Response{}, nil)
+			as.On("Get", ctx, appID).Return(&godo.App{ID: appID, LiveURL: "https://example.com"}, &godo.Response{}, nil)
+			return as
+		}(),
+		inputs: inputs{skipIfUnchanged: true, forceRebuild: true},
+		expectedLogs: []byte(`app "foo" is unchanged, only forcing a rebuild
+forcing a rebuild of all components
+wait for deployment to finish
+deployment is in phase: ACTIVE
+`),
+		expectedResult: &deployResult{
+			App:        &godo.App{ID: appID, LiveURL: "https://example.com"},
+			Deployment: &godo.Deployment{Phase: godo.DeploymentPhase_Active},
+		},
+	}, {
+		name: "forced rebuild supersedes the update's deployment",
+		appService: func() *mockedAppsService {
+			as := &mockedAppsService{}
+			as.On("List", ctx, mock.Anything).Return([]*godo.App{{ID: appID, Spec: spec}}, &godo.Response{}, nil)
+			as.On("Update", ctx, appID, mock.Anything).Return(&godo.App{ID: appID, PendingDeployment: &godo.Deployment{ID: "update-id"}}, &godo.Response{}, nil)
+			as.On("CreateDeployment", ctx, appID, []*godo.DeploymentCreateRequest{{ForceBuild: true}}).Return(&godo.Deployment{ID: deploymentID}, &godo.Response{}, nil)
+			as.On("GetDeployment", ctx, appID, deploymentID).Return(&godo.Deployment{
+				Phase: godo.DeploymentPhase_Active,
+			}, &godo.Response{}, nil)
+			as.On("GetLogs", ctx, appID, deploymentID, "", godo.AppLogTypeBuild, true, -1).Return(&godo.AppLogs{}, &godo.Response{}, nil)
+			as.On("GetLogs", ctx, appID, deploymentID, "", godo.AppLogTypeDeploy, true, -1).Return(&godo.AppLogs{}, &godo.Response{}, nil)
+			as.On("Get", ctx, appID).Return(&godo.App{ID: appID, LiveURL: "https://example.com"}, &godo.Response{}, nil)
+			return as
+		}(),
+		inputs: inputs{forceRebuild: true},
+		expectedLogs: []byte(`app "foo" already exists, updating...
+superseding deployment update-id triggered by the update
+forcing a rebuild of all components
+wait for deployment to finish
+deployment is in phase: ACTIVE
+`),
+		expectedResult: &deployResult{
+			App:        &godo.App{ID: appID, LiveURL: "https://example.com"},
+			Deployment: &godo.Deployment{Phase: godo.DeploymentPhase_Active},
+		},
 	}, {
 		name: "fails to deploy",
 		appService: func() *mockedAppsService {
 			as := &mockedAppsService{}
 			as.On("List", ctx, mock.Anything).Return([]*godo.App{{ID: appID, Spec: spec}}, &godo.Response{}, nil)
-			as.On("Update", ctx, appID, mock.Anything).Return(&godo.App{ID: appID}, &godo.Response{}, nil)
-			as.On("ListDeployments", ctx, appID, mock.Anything).Return([]*godo.Deployment{{
-				ID: deploymentID,
-			}}, &godo.Response{}, nil)
+			as.On("Update", ctx, appID, mock.Anything).Return(&godo.App{ID: appID, PendingDeployment: &godo.Deployment{ID: deploymentID}}, &godo.Response{}, nil)
 			as.On("GetDeployment", ctx, appID, deploymentID).Return(&godo.Deployment{
 				Phase: godo.DeploymentPhase_Error,
 			}, &godo.Response{}, nil)
@@ -325,12 +433,42 @@ _GitHubActionsFileCommandDelimeter_
 wait for deployment to finish
 deployment is in phase: ERROR
 `),
+		expectedResult: &deployResult{
+			App:        &godo.App{ID: appID},
+			Deployment: &godo.Deployment{Phase: godo.DeploymentPhase_Error},
+			Created:    false,
+			BuildLogs:  []byte("build log"),
+			DeployLogs: []byte("deploy log"),
+		},
 		expectedOutput: []byte(`build_logs<<_GitHubActionsFileCommandDelimeter_
 build log
 _GitHubActionsFileCommandDelimeter_
 deploy_logs<<_GitHubActionsFileCommandDelimeter_
 deploy log
 _GitHubActionsFileCommandDelimeter_
+`),
+	}, {
+		name: "skips unchanged app",
+		appService: func() *mockedAppsService {
+			as := &mockedAppsService{}
+			as.On("List", ctx, mock.Anything).Return([]*godo.App{{
+				ID:               appID,
+				Spec:             &godo.AppSpec{Name: "foo", Region: "nyc"},
+				ActiveDeployment: &godo.Deployment{ID: deploymentID},
+			}}, &godo.Response{}, nil)
+			return as
+		}(),
+		inputs: inputs{skipIfUnchanged: true},
+		expectedResult: &deployResult{
+			App: &godo.App{
+				ID:               appID,
+				Spec:             &godo.AppSpec{Name: "foo", Region: "nyc"},
+				ActiveDeployment: &godo.Deployment{ID: deploymentID},
+			},
+			Deployment: &godo.Deployment{ID: deploymentID},
+			Skipped:    true,
+		},
+		expectedLogs: []byte(`app "foo" is unchanged, skipping deployment
 `),
 	}, {
 		name: "fails to list apps",
@@ -352,38 +490,41 @@ _GitHubActionsFileCommandDelimeter_
 		expectedLogs: []byte(`app "foo" does not exist yet, creating...
 `),
 	}, {
-		name: "fails to list deployments",
+		name: "fails to create deployment if none is pending",
 		appService: func() *mockedAppsService {
 			as := &mockedAppsService{}
-			as.On("List", ctx, mock.Anything).Return([]*godo.App{}, &godo.Response{}, nil)
-			as.On("Create", ctx, mock.Anything).Return(&godo.App{ID: appID}, &godo.Response{}, nil)
-			as.On("ListDeployments", ctx, appID, mock.Anything).Return([]*godo.Deployment{}, &godo.Response{}, errors.New("an error"))
+			as.On("List", ctx, mock.Anything).Return([]*godo.App{{ID: appID, Spec: spec}}, &godo.Response{}, nil)
+			as.On("Update", ctx, appID, mock.Anything).Return(&godo.App{ID: appID}, &godo.Response{}, nil)
+			as.On("CreateDeployment", ctx, appID, mock.Anything).Return(&godo.Deployment{}, &godo.Response{}, errors.New("an error"))
 			return as
 		}(),
 		err: true,
-		expectedLogs: []byte(`app "foo" does not exist yet, creating...
+		expectedLogs: []byte(`app "foo" already exists, updating...
+the app change didn't trigger a deployment, creating one
 `),
 	}, {
-		name: "returns an empty deployment list",
+		name: "pending deployment was triggered by someone else",
 		appService: func() *mockedAppsService {
 			as := &mockedAppsService{}
-			as.On("List", ctx, mock.Anything).Return([]*godo.App{}, &godo.Response{}, nil)
-			as.On("Create", ctx, mock.Anything).Return(&godo.App{ID: appID}, &godo.Response{}, nil)
-			as.On("ListDeployments", ctx, appID, mock.Anything).Return([]*godo.Deployment{}, &godo.Response{}, nil)
+			as.On("List", ctx, mock.Anything).Return([]*godo.App{{ID: appID, Spec: spec}}, &godo.Response{}, nil)
+			as.On("Update", ctx, appID, mock.Anything).Return(&godo.App{ID: appID, PendingDeployment: &godo.Deployment{
+				ID: "other",
+				CauseDetails: &godo.DeploymentCauseDetails{
+					Type:    godo.DeploymentCauseDetailsType_DeployOnPush,
+					GitPush: &godo.DeploymentCauseDetailsGitPush{CommitSHA: "0123456789", Username: "someone"},
+				},
+			}}, &godo.Response{}, nil)
 			return as
 		}(),
 		err: true,
-		expectedLogs: []byte(`app "foo" does not exist yet, creating...
+		expectedLogs: []byte(`app "foo" already exists, updating...
 `),
 	}, {
 		name: "fails to get deployment for phase poll",
 		appService: func() *mockedAppsService {
 			as := &mockedAppsService{}
 			as.On("List", ctx, mock.Anything).Return([]*godo.App{}, &godo.Response{}, nil)
-			as.On("Create", ctx, mock.Anything).Return(&godo.App{ID: appID}, &godo.Response{}, nil)
-			as.On("ListDeployments", ctx, appID, mock.Anything).Return([]*godo.Deployment{{
-				ID: deploymentID,
-			}}, &godo.Response{}, nil)
+			as.On("Create", ctx, mock.Anything).Return(&godo.App{ID: appID, PendingDeployment: &godo.Deployment{ID: deploymentID}}, &godo.Response{}, nil)
 			as.On("GetDeployment", ctx, appID, deploymentID).Return(&godo.Deployment{}, &godo.Response{}, errors.New("an error"))
 			return as
 		}(),
@@ -396,10 +537,7 @@ wait for deployment to finish
 		appService: func() *mockedAppsService {
 			as := &mockedAppsService{}
 			as.On("List", ctx, mock.Anything).Return([]*godo.App{}, &godo.Response{}, nil)
-			as.On("Create", ctx, mock.Anything).Return(&godo.App{ID: appID}, &godo.Response{}, nil)
-			as.On("ListDeployments", ctx, appID, mock.Anything).Return([]*godo.Deployment{{
-				ID: deploymentID,
-			}}, &godo.Response{}, nil)
+			as.On("Create", ctx, mock.Anything).Return(&godo.App{ID: appID, PendingDeployment: &godo.Deployment{ID: deploymentID}}, &godo.Response{}, nil)
 			as.On("GetDeployment", ctx, appID, deploymentID).Return(&godo.Deployment{
 				Phase: godo.DeploymentPhase_Active,
 			}, &godo.Response{}, nil)
@@ -418,10 +556,7 @@ deployment is in phase: ACTIVE
 		appService: func() *mockedAppsService {
 			as := &mockedAppsService{}
 			as.On("List", ctx, mock.Anything).Return([]*godo.App{}, &godo.Response{}, nil)
-			as.On("Create", ctx, mock.Anything).Return(&godo.App{ID: appID}, &godo.Response{}, nil)
-			as.On("ListDeployments", ctx, appID, mock.Anything).Return([]*godo.Deployment{{
-				ID: deploymentID,
-			}}, &godo.Response{}, nil)
+			as.On("Create", ctx, mock.Anything).Return(&godo.App{ID: appID, PendingDeployment: &godo.Deployment{ID: deploymentID}}, &godo.Response{}, nil)
 			as.On("GetDeployment", ctx, appID, deploymentID).Return(&godo.Deployment{
 				Phase: godo.DeploymentPhase_Active,
 			}, &godo.Response{}, nil)
@@ -443,10 +578,7 @@ deployment is in phase: ACTIVE
 		appService: func() *mockedAppsService {
 			as := &mockedAppsService{}
 			as.On("List", ctx, mock.Anything).Return([]*godo.App{}, &godo.Response{}, nil)
-			as.On("Create", ctx, mock.Anything).Return(&godo.App{ID: appID}, &godo.Response{}, nil)
-			as.On("ListDeployments", ctx, appID, mock.Anything).Return([]*godo.Deployment{{
-				ID: deploymentID,
-			}}, &godo.Response{}, nil)
+			as.On("Create", ctx, mock.Anything).Return(&godo.App{ID: appID, PendingDeployment: &godo.Deployment{ID: deploymentID}}, &godo.Response{}, nil)
 			as.On("GetDeployment", ctx, appID, deploymentID).Return(&godo.Deployment{
 				Phase: godo.DeploymentPhase_Active,
 			}, &godo.Response{}, nil)
@@ -483,13 +615,16 @@ deployment is in phase: ACTIVE
 				httpClient: &http.Client{Transport: test.logsRT},
 				inputs:     test.inputs,
 			}
-			_, err := d.deploy(ctx, spec)
+			res, err := d.deploy(ctx, spec)
 			if err != nil && !test.err {
 				t.Fatalf("unexpected error: %v", err)
 			}
 			if err == nil && test.err {
 				t.Fatalf("expected an error")
 			}
+			if test.expectedResult != nil {
+				require.Equal(t, test.expectedResult, res)
+			}
 
 			require.Equal(t, test.expectedLogs, actionLogs.Bytes())
 
@@ -506,6 +641,150 @@ deployment is in phase: ACTIVE
 	}
 }
 
+func TestDeploySelectedComponents(t *testing.T) {
+	ctx := context.Background()
+	live := &godo.AppSpec{
+		Name: "foo",
+		Services: []*godo.AppServiceSpec{
+			{Name: "web", Image: &godo.ImageSourceSpec{RegistryType: godo.ImageSourceSpecRegistryType_DOCR, Repository: "web", Tag: "v1"}},
+			{Name: "api", Image: &godo.ImageSourceSpec{RegistryType: godo.ImageSourceSpecRegistryType_DOCR, Repository: "api", Tag: "v1"}},
+		},
+	}
+	spec := &godo.AppSpec{
+		Name: "foo",
+		Services: []*godo.AppServiceSpec{
+			{Name: "web", Image: &godo.ImageSourceSpec{RegistryType: godo.ImageSourceSpecRegistryType_DOCR, Repository: "web", Tag: "v2"}},
+			{Name: "api", Image: &godo.ImageSourceSpec{RegistryType: godo.ImageSourceSpecRegistryType_DOCR, Repository: "api", Tag: "v2"}},
+		},
+	}
+
+	as := &mockedAppsService{}
+	as.On("List", ctx, mock.Anything).Return([]*godo.App{{ID: "app-id", Spec: live}}, &godo.Response{}, nil)
+	as.On("Update", ctx, "app-id", mock.MatchedBy(func(req *godo.AppUpdateRequest) bool {
+		// Only the selected component's source changes, the others keep their
+		// source versions.
+		if req.UpdateAllSourceVersions || req.Spec.Services[0].Image.Tag != "v2" || req.Spec.Services[1].Image.Tag != "v1" {
+			return false
+		}
+		// Secrets are injected into the existing app's variables and components.
+		return reflect.DeepEqual(req.Spec.Envs, []*godo.AppVariableDefinition{{Key: "API_KEY", Value: "rotated-key", Type: godo.AppVariableType_Secret}}) &&
+			reflect.DeepEqual(req.Spec.Services[1].Envs, []*godo.AppVariableDefinition{{Key: "DB_PASSWORD", Value: "rotated-password", Type: godo.AppVariableType_Secret}})
+	})).Return(&godo.App{ID: "app-id", PendingDeployment: &godo.Deployment{ID: "deployment-id"}}, &godo.Response{}, nil)
+	as.On("GetDeployment", ctx, "app-id", "deployment-id").Return(&godo.Deployment{
+		Phase: godo.DeploymentPhase_Active,
+	}, &godo.Response{}, nil)
+	as.On("GetLogs", ctx, "app-id", "deployment-id", "", mock.Anything, true, -1).Return(&godo.AppLogs{}, &godo.Response{}, nil)
+	as.On("Get", ctx, "app-id").Return(&godo.App{ID: "app-id", LiveURL: "https://example.com"}, &godo.Response{}, nil)
+
+	d := &deployer{
+		action: gha.New(gha.WithWriter(io.Discard), gha.WithGetenv(func(string) string { return "" })),
+		apps:   as,
+		inputs: inputs{components: []string{"web"}, secrets: []secretRef{
+			{Key: "API_KEY", Var: "API_KEY"},
+			{Component: "api", Key: "DB_PASSWORD", Var: "DB_PASSWORD"},
+		}},
+	}
+	t.Setenv("API_KEY", "rotated-key")
+	t.Setenv("DB_PASSWORD", "rotated-password")
+	_, err := d.deploy(ctx, spec)
+	require.NoError(t, err)
+	as.AssertExpectations(t)
+
+	// The latest commit of an unchanged Git source isn't fetched, so the app must
+	// not be updated.
+	github := &godo.GitHubSourceSpec{Repo: "org/repo", Branch: "main"}
+	live.Services[0].Image, spec.Services[0].Image = nil, nil
+	live.Services[0].GitHub, spec.Services[0].GitHub = github, github
+	as = &mockedAppsService{}
+	as.On("List", ctx, mock.Anything).Return([]*godo.App{{ID: "app-id", Spec: live}}, &godo.Response{}, nil)
+	d.apps = as
+	_, err = d.deploy(ctx, spec)
+	require.EqualError(t, err, `component "web" is deployed from the same Git branch as before, whose latest commit is only fetched when deploying all components`)
+	as.AssertExpectations(t)
+}
+
+func TestWaitForDomainActive(t *testing.T) {
+	ctx := context.Background()
+	appID := "app-id"
+	domain := "pr-3.preview.example.com"
+
+	tests := []struct {
+		name         string
+		appService   *mockedAppsService
+		expectedLogs []byte
+		err          bool
+	}{{
+		name: "success",
+		appService: func() *mockedAppsService {
+			as := &mockedAppsService{}
+			as.On("Get", ctx, appID).Return(&godo.App{ID: appID, Domains: []*godo.AppDomain{{
+				Spec:  &godo.AppDomainSpec{Domain: "other.example.com"},
+				Phase: godo.AppJobSpecKindPHASE_Error,
+			}, {
+				Spec:  &godo.AppDomainSpec{Domain: domain},
+				Phase: godo.AppJobSpecKindPHASE_Active,
+			}}}, &godo.Response{}, nil)
+			return as
+		}(),
+		expectedLogs: []byte(`domain is in phase: ACTIVE
+`),
+	}, {
+		name: "domain fails",
+		appService: func() *mockedAppsService {
+			as := &mockedAppsService{}
+			as.On("Get", ctx, appID).Return(&godo.App{ID: appID, Domains: []*godo.AppDomain{{
+				Spec:  &godo.AppDomainSpec{Domain: domain},
+				Phase: godo.AppJobSpecKindPHASE_Error,
+			}}}, &godo.Response{}, nil)
+			return as
+		}(),
+		err: true,
+		expectedLogs: []byte(`domain is in phase: ERROR
+`),
+	}, {
+		name: "fails to get app",
+		appService: func() *mockedAppsService {
+			as := &mockedAppsService{}
+			as.On("Get", ctx, appID).Return(&godo.App{}, &godo.Response{}, errors.New("an error"))
+			return as
+		}(),
+		err: true,
+	}, {
+		name: "domain never shows up",
+		appService: func() *mockedAppsService {
+			as := &mockedAppsService{}
+			as.On("Get", ctx, appID).Return(&godo.App{ID: appID, Domains: []*godo.AppDomain{{
+				Spec:  &godo.AppDomainSpec{Domain: "other.example.com"},
+				Phase: godo.AppJobSpecKindPHASE_Active,
+			}}}, &godo.Response{}, nil)
+			return as
+		}(),
+		err: true,
+	}}
+
+	defer func(timeout time.Duration) { domainAppearTimeout = timeout }(domainAppearTimeout)
+	domainAppearTimeout = 10 * time.Millisecond
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var actionLogs bytes.Buffer
+			d := &deployer{
+				action: gha.New(gha.WithWriter(&actionLogs)),
+				apps:   test.appService,
+				inputs: inputs{pollInterval: time.Millisecond},
+			}
+			_, err := d.waitForDomainActive(ctx, appID, domain)
+			if test.err {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, test.expectedLogs, actionLogs.Bytes())
+			test.appService.AssertExpectations(t)
+		})
+	}
+}
+
 type mockedRoundtripper struct {
 	mock.Mock
 }
@@ -550,6 +829,11 @@ func (m *mockedAppsService) ListDeployments(ctx context.Context, appID string, o
 	return args.Get(0).([]*godo.Deployment), args.Get(1).(*godo.Response), args.Error(2)
 }
 
+func (m *mockedAppsService) CreateDeployment(ctx context.Context, appID string, create ...*godo.DeploymentCreateRequest) (*godo.Deployment, *godo.Response, error) {
+	args := m.Called(ctx, appID, create)
+	return args.Get(0).(*godo.Deployment), args.Get(1).(*godo.Response), args.Error(2)
+}
+
 func (m *mockedAppsService) GetLogs(ctx context.Context, appID, deploymentID, component string, logType godo.AppLogType, follow bool, tailLines int) (*godo.AppLogs, *godo.Response, error) {
 	args := m.Called(ctx, appID, deploymentID, component, logType, follow, tailLines)
 	return args.Get(0).(*godo.AppLogs), args.Get(1).(*godo.Response), args.Error(2)
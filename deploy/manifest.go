@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// manifest describes multiple apps and the order they have to be deployed in.
+type manifest struct {
+	Apps []manifestApp `json:"apps"`
+}
+
+// manifestApp describes an app in a manifest.
+type manifestApp struct {
+	// Name is the name the app is referenced by in dependencies.
+	Name string `json:"name"`
+	// Spec is the location of the app's spec, relative to the manifest.
+	Spec string `json:"spec"`
+	// DependsOn are the names of the apps that have to be live before this app
+	// is deployed.
+	DependsOn []string `json:"depends_on,omitempty"`
+}
+
+// readManifest reads the manifest from the given location.
+func readManifest(location string) (*manifest, error) {
+	bs, err := os.ReadFile(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var m manifest
+	if err := yaml.UnmarshalStrict(bs, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	// Resolve spec locations relative to the manifest.
+	for i := range m.Apps {
+		if m.Apps[i].Spec != "" && !filepath.IsAbs(m.Apps[i].Spec) {
+			m.Apps[i].Spec = filepath.Join(filepath.Dir(location), m.Apps[i].Spec)
+		}
+	}
+	return &m, nil
+}
+
+// deployments validates the manifest and returns the apps to deploy in
+// topological order, i.e. every app comes after all of its dependencies.
+func (m *manifest) deployments() ([]*appDeployment, error) {
+	if len(m.Apps) == 0 {
+		return nil, fmt.Errorf("manifest doesn't contain any apps")
+	}
+
+	apps := make(map[string]manifestApp, len(m.Apps))
+	for _, app := range m.Apps {
+		if app.Name == "" {
+			return nil, fmt.Errorf("app with spec %q has no name", app.Spec)
+		}
+		if app.Spec == "" {
+			return nil, fmt.Errorf("app %q has no spec", app.Name)
+		}
+		if _, ok := apps[app.Name]; ok {
+			return nil, fmt.Errorf("app %q is defined more than once", app.Name)
+		}
+		apps[app.Name] = app
+	}
+	for _, app := range m.Apps {
+		for _, dep := range app.DependsOn {
+			if _, ok := apps[dep]; !ok {
+				return nil, fmt.Errorf("app %q depends on unknown app %q", app.Name, dep)
+			}
+		}
+	}
+
+	// Sort the apps topologically via a depth-first search, keeping the order of
+	// the manifest where possible.
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(m.Apps))
+	deployments := make([]*appDeployment, 0, len(m.Apps))
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependency cycle detected: %s", strings.Join(append(path, name), " -> "))
+		}
+
+		state[name] = visiting
+		app := apps[name]
+		for _, dep := range app.DependsOn {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+
+		deployments = append(deployments, &appDeployment{
+			name:      app.Name,
+			location:  app.Spec,
+			dependsOn: app.DependsOn,
+		})
+		return nil
+	}
+	for _, app := range m.Apps {
+		if err := visit(app.Name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return deployments, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadManifest(t *testing.T) {
+	dir := t.TempDir()
+	location := filepath.Join(dir, "apps.yaml")
+	require.NoError(t, os.WriteFile(location, []byte(`apps:
+- name: api
+  spec: api.yaml
+- name: frontend
+  spec: /abs/frontend.yaml
+  depends_on: [api]
+`), 0644))
+
+	m, err := readManifest(location)
+	require.NoError(t, err)
+	require.Equal(t, &manifest{Apps: []manifestApp{{
+		Name: "api",
+		Spec: filepath.Join(dir, "api.yaml"), // Resolved relative to the manifest.
+	}, {
+		Name:      "frontend",
+		Spec:      "/abs/frontend.yaml",
+		DependsOn: []string{"api"},
+	}}}, m)
+
+	require.NoError(t, os.WriteFile(location, []byte(`apps:
+- name: api
+  spec: api.yaml
+  dependson: [foo]
+`), 0644))
+	_, err = readManifest(location)
+	require.Error(t, err, "unknown fields should be rejected")
+}
+
+func TestManifestDeployments(t *testing.T) {
+	tests := []struct {
+		name     string
+		apps     []manifestApp
+		expected []*appDeployment
+		err      string
+	}{{
+		name: "topological order",
+		apps: []manifestApp{
+			{Name: "frontend", Spec: "frontend.yaml", DependsOn: []string{"api", "auth"}},
+			{Name: "api", Spec: "api.yaml", DependsOn: []string{"db"}},
+			{Name: "db", Spec: "db.yaml"},
+			{Name: "auth", Spec: "auth.yaml"},
+		},
+		expected: []*appDeployment{
+			{name: "db", location: "db.yaml"},
+			{name: "api", location: "api.yaml", dependsOn: []string{"db"}},
+			{name: "auth", location: "auth.yaml"},
+			{name: "frontend", location: "frontend.yaml", dependsOn: []string{"api", "auth"}},
+		},
+	}, {
+		name: "cycle",
+		apps: []manifestApp{
+			{Name: "a", Spec: "a.yaml", DependsOn: []string{"b"}},
+			{Name: "b", Spec: "b.yaml", DependsOn: []string{"c"}},
+			{Name: "c", Spec: "c.yaml", DependsOn: []string{"a"}},
+		},
+		err: "dependency cycle detected: a -> b -> c -> a",
+	}, {
+		name: "self dependency",
+		apps: []manifestApp{{Name: "a", Spec: "a.yaml", DependsOn: []string{"a"}}},
+		err:  "dependency cycle detected: a -> a",
+	}, {
+		name: "unknown dependency",
+		apps: []manifestApp{{Name: "a", Spec: "a.yaml", DependsOn: []string{"b"}}},
+		err:  `app "a" depends on unknown app "b"`,
+	}, {
+		name: "duplicate app",
+		apps: []manifestApp{{Name: "a", Spec: "a.yaml"}, {Name: "a", Spec: "b.yaml"}},
+		err:  `app "a" is defined more than once`,
+	}, {
+		name: "missing spec",
+		apps: []manifestApp{{Name: "a"}},
+		err:  `app "a" has no spec`,
+	}, {
+		name: "empty",
+		err:  "manifest doesn't contain any apps",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := &manifest{Apps: test.apps}
+			got, err := m.deployments()
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, got)
+		})
+	}
+}
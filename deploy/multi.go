@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/digitalocean/godo"
+	gha "github.com/sethvargo/go-githubactions"
+)
+
+// appDeployment describes one of many apps to deploy.
+type appDeployment struct {
+	// name is the name the app is referenced by in dependencies.
+	name string
+	// location is the location of the app's spec.
+	location string
+	// dependsOn are the names of the apps that have to be live before this app
+	// is deployed.
+	dependsOn []string
+}
+
+// appResult is the result of deploying one of many apps.
+type appResult struct {
+	// Name is the name of the app, or the name the app is referenced by in
+	// dependencies if the spec could not be created.
+	Name string `json:"-"`
+	// Location is the location of the app spec the app was deployed from.
+	Location string `json:"location"`
+	// App is the app after the deployment, if it got that far.
+	App *godo.App `json:"app,omitempty"`
+	// Error is the error that occurred while deploying the app, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// specLocations resolves the given app spec locations into the list of app spec
+// files to deploy. Locations containing glob patterns are expanded.
+func specLocations(locations []string) ([]string, error) {
+	seen := make(map[string]struct{})
+	var files []string
+	for _, location := range locations {
+		matches := []string{location}
+		if strings.ContainsAny(location, "*?[") {
+			var err error
+			matches, err = filepath.Glob(location)
+			if err != nil {
+				return nil, fmt.Errorf("invalid app spec pattern %q: %w", location, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no app spec matches %q", location)
+			}
+			sort.Strings(matches)
+		}
+
+		for _, match := range matches {
+			if _, ok := seen[match]; ok {
+				continue
+			}
+			seen[match] = struct{}{}
+			files = append(files, match)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no app spec location given")
+	}
+	return files, nil
+}
+
+// deploymentsFromLocations returns independent deployments for all given locations.
+func deploymentsFromLocations(locations []string) []*appDeployment {
+	deployments := make([]*appDeployment, 0, len(locations))
+	for _, location := range locations {
+		deployments = append(deployments, &appDeployment{name: location, location: location})
+	}
+	return deployments
+}
+
+// deployMany deploys the given apps concurrently. Apps are only deployed once all
+// of their dependencies are live and the live URL of each dependency is passed to
+// the app's spec as the LIVE_URL_<DEPENDENCY> variable. The dependencies must not
+// contain cycles.
+// The results are returned in the order of the given apps.
+func (d *deployer) deployMany(ctx context.Context, apps []*appDeployment) ([]*appResult, error) {
+	if err := d.checkDuplicateAppNames(ctx, apps); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	parallelism := d.inputs.maxParallelDeployments
+	if parallelism <= 0 || parallelism > len(apps) {
+		parallelism = len(apps)
+	}
+	sem := make(chan struct{}, parallelism)
+
+	results := make([]*appResult, len(apps))
+	byName := make(map[string]*appResult, len(apps))
+	done := make(map[string]chan struct{}, len(apps))
+	for i, app := range apps {
+		results[i] = &appResult{Name: app.name, Location: app.location}
+		byName[app.name] = results[i]
+		done[app.name] = make(chan struct{})
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []string
+	)
+	for i, app := range apps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[app.name])
+
+			res := results[i]
+			err := d.awaitDependencies(ctx, app, done, byName)
+			var logs []byte
+			if err == nil {
+				env := make(map[string]string, len(app.dependsOn))
+				for _, dep := range app.dependsOn {
+					env["LIVE_URL_"+componentNameToEnvVar(dep)] = byName[dep].App.GetLiveURL()
+				}
+
+				sem <- struct{}{}
+				if err = ctx.Err(); err == nil {
+					var name string
+					name, res.App, logs, err = d.deployFromLocation(ctx, app.location, env)
+					if name != "" {
+						res.Name = name
+					}
+				}
+				<-sem
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			// Flush the app's logs in one go to avoid interleaving them with other apps.
+			d.action.Infof("==> %s (%s)", res.Name, app.location)
+			if len(logs) > 0 {
+				d.action.Infof("%s", bytes.TrimSuffix(logs, []byte("\n")))
+			}
+
+			if err != nil {
+				res.Error = err.Error()
+				failed = append(failed, res.Name)
+				annotateSpecProblems(d.action, err)
+				specErrorAction(d.action, err).Errorf("failed to deploy %q: %v", res.Name, err)
+				if d.inputs.failFast {
+					cancel()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return results, fmt.Errorf("failed to deploy %d of %d apps: %s", len(failed), len(apps), strings.Join(failed, ", "))
+	}
+	return results, nil
+}
+
+// checkDuplicateAppNames fails if the specs of any of the given apps define the
+// same app, since they would overwrite each other. Specs that can't be created
+// are skipped, their deployment reports the error.
+func (d *deployer) checkDuplicateAppNames(ctx context.Context, apps []*appDeployment) error {
+	sub := *d
+	sub.action = gha.New(gha.WithWriter(io.Discard), gha.WithGetenv(d.action.Getenv))
+	// Only the name matters, so skip everything with side effects or that might
+	// depend on the live URLs of dependencies.
+	sub.inputs.appName = ""
+	sub.inputs.build = false
+	sub.inputs.strictSpec = false
+	sub.inputs.unresolvedVariables = unresolvedVariablesIgnore
+
+	locations := make(map[string]string, len(apps))
+	for _, app := range apps {
+		sub.inputs.appSpecLocation = app.location
+		spec, err := sub.createSpec(ctx)
+		if err != nil || spec.GetName() == "" {
+			continue
+		}
+		if other, ok := locations[spec.GetName()]; ok {
+			return fmt.Errorf("app specs %s and %s both define app %q", other, app.location, spec.GetName())
+		}
+		locations[spec.GetName()] = app.location
+	}
+	return nil
+}
+
+// awaitDependencies waits for all dependencies of the given app to be done and
+// returns an error if any of them failed.
+func (d *deployer) awaitDependencies(ctx context.Context, app *appDeployment, done map[string]chan struct{}, results map[string]*appResult) error {
+	for _, dep := range app.dependsOn {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-done[dep]:
+		}
+		if results[dep].Error != "" {
+			return fmt.Errorf("dependency %q failed to deploy", dep)
+		}
+	}
+	return nil
+}
+
+// deployFromLocation creates the spec from the given location and deploys it. The
+// given variables are available to the spec in addition to the environment. All
+// logs are buffered and returned rather than printed directly.
+func (d *deployer) deployFromLocation(ctx context.Context, location string, env map[string]string) (string, *godo.App, []byte, error) {
+	var logs bytes.Buffer
+	sub := *d
+	sub.inputs.appSpecLocation = location
+	// The location takes precedence over app_name.
+	sub.inputs.appName = ""
+	sub.env = env
+	sub.action = gha.New(gha.WithWriter(&logs), gha.WithGetenv(func(k string) string {
+		if k == "GITHUB_OUTPUT" {
+			// Outputs of the individual apps are aggregated into the `apps` output instead.
+			return os.DevNull
+		}
+		return d.action.Getenv(k)
+	}))
+
+	spec, err := sub.createSpec(ctx)
+	if err != nil {
+		return "", nil, logs.Bytes(), fmt.Errorf("failed to create spec: %w", err)
+	}
+	var res *deployResult
+	if sub.inputs.waitOnly {
+		res, err = sub.waitForPushDeployment(ctx, spec.GetName())
+	} else {
+		if err := sub.prepareSpec(ctx, spec); err != nil {
+			return spec.GetName(), nil, logs.Bytes(), fmt.Errorf("failed to prepare spec: %w", err)
+		}
+		res, err = sub.deploy(ctx, spec)
+	}
+	if res == nil {
+		return spec.GetName(), nil, logs.Bytes(), err
+	}
+	// The app ends up in the `apps` output, so it must not contain secrets.
+	app, scrubErr := scrubSecrets(res.App)
+	if scrubErr != nil {
+		return spec.GetName(), nil, logs.Bytes(), errors.Join(err, fmt.Errorf("failed to scrub secrets from app: %w", scrubErr))
+	}
+	return spec.GetName(), app, logs.Bytes(), err
+}
+
+// resultsByName returns the given results keyed by their name.
+func resultsByName(results []*appResult) map[string]*appResult {
+	m := make(map[string]*appResult, len(results))
+	for _, res := range results {
+		m[res.Name] = res
+	}
+	return m
+}
+
+// manySummary renders a markdown summary of the given results.
+func manySummary(results []*appResult) string {
+	var b strings.Builder
+	b.WriteString("### Deployed apps\n\n")
+	b.WriteString("| App | Spec | Status | Live URL |\n")
+	b.WriteString("| --- | --- | --- | --- |\n")
+	for _, res := range results {
+		status := ":white_check_mark: deployed"
+		if res.Error != "" {
+			status = ":x: " + strings.ReplaceAll(res.Error, "|", "\\|")
+		}
+		fmt.Fprintf(&b, "| %s | `%s` | %s | %s |\n", res.Name, res.Location, status, res.App.GetLiveURL())
+	}
+	return b.String()
+}
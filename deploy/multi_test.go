@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/digitalocean/godo"
+	gha "github.com/sethvargo/go-githubactions"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpecLocations(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"a.yaml", "b.yaml", "c.yml"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, f), []byte("name: foo"), 0644))
+	}
+
+	tests := []struct {
+		name      string
+		locations []string
+		expected  []string
+		err       bool
+	}{{
+		name:      "single file",
+		locations: []string{".do/app.yaml"},
+		expected:  []string{".do/app.yaml"},
+	}, {
+		name:      "glob",
+		locations: []string{filepath.Join(dir, "*.yaml")},
+		expected:  []string{filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml")},
+	}, {
+		name:      "list with duplicates",
+		locations: []string{filepath.Join(dir, "c.yml"), filepath.Join(dir, "*.y*ml")},
+		expected:  []string{filepath.Join(dir, "c.yml"), filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml")},
+	}, {
+		name:      "glob without matches",
+		locations: []string{filepath.Join(dir, "*.json")},
+		err:       true,
+	}, {
+		name: "empty",
+		err:  true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := specLocations(test.locations)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, got)
+		})
+	}
+}
+
+func TestDeployMany(t *testing.T) {
+	dir := t.TempDir()
+	fooLocation := filepath.Join(dir, "foo.yaml")
+	barLocation := filepath.Join(dir, "bar.yaml")
+	brokenLocation := filepath.Join(dir, "broken.yaml")
+	require.NoError(t, os.WriteFile(fooLocation, []byte("name: foo"), 0644))
+	require.NoError(t, os.WriteFile(barLocation, []byte("name: bar"), 0644))
+	require.NoError(t, os.WriteFile(brokenLocation, []byte("name: [foo"), 0644))
+
+	as := &mockedAppsService{}
+	as.On("List", mock.Anything, mock.Anything).Return([]*godo.App{}, &godo.Response{}, nil)
+	as.On("Create", mock.Anything, mock.MatchedBy(func(req *godo.AppCreateRequest) bool {
+		return req.Spec.Name == "foo"
+	})).Return(&godo.App{ID: "foo-id", PendingDeployment: &godo.Deployment{ID: "deployment-id"}}, &godo.Response{}, nil)
+	as.On("Create", mock.Anything, mock.MatchedBy(func(req *godo.AppCreateRequest) bool {
+		return req.Spec.Name == "bar"
+	})).Return(&godo.App{}, &godo.Response{}, errors.New("an error"))
+	as.On("GetDeployment", mock.Anything, "foo-id", "deployment-id").Return(&godo.Deployment{
+		Phase: godo.DeploymentPhase_Active,
+	}, &godo.Response{}, nil)
+	as.On("GetLogs", mock.Anything, "foo-id", "deployment-id", "", mock.Anything, true, -1).Return(&godo.AppLogs{},
+		&godo.Response{Response: &http.Response{StatusCode: http.StatusBadRequest}}, errors.New("an error"))
+	as.On("Get", mock.Anything, "foo-id").Return(&godo.App{ID: "foo-id", LiveURL: "https://example.com"}, &godo.Response{}, nil)
+
+	var actionLogs bytes.Buffer
+	d := &deployer{
+		action: gha.New(gha.WithWriter(&actionLogs), gha.WithGetenv(func(string) string { return "" })),
+		apps:   as,
+		// app_name is ignored in favor of the app specs.
+		inputs: inputs{maxParallelDeployments: 1, appName: "other"},
+	}
+
+	results, err := d.deployMany(context.Background(), deploymentsFromLocations([]string{fooLocation, barLocation, brokenLocation}))
+	require.ErrorContains(t, err, "failed to deploy 2 of 3 apps")
+
+	require.Len(t, results, 3)
+	require.Equal(t, &appResult{
+		Name:     "foo",
+		Location: fooLocation,
+		App:      &godo.App{ID: "foo-id", LiveURL: "https://example.com"},
+	}, results[0])
+	require.Equal(t, "bar", results[1].Name)
+	require.Contains(t, results[1].Error, "failed to create app")
+	require.Equal(t, brokenLocation, results[2].Name)
+	require.Contains(t, results[2].Error, "failed to parse app spec")
+
+	require.Contains(t, actionLogs.String(), `==> foo (`+fooLocation+`)
+app "foo" does not exist yet, creating...
+wait for deployment to finish
+deployment is in phase: ACTIVE
+`)
+
+	summary := manySummary(results)
+	require.Contains(t, summary, "| foo | `"+fooLocation+"` | :white_check_mark: deployed | https://example.com |")
+
+	as.AssertExpectations(t)
+}
+
+func TestDeployManyWithDependencies(t *testing.T) {
+	dir := t.TempDir()
+	apiLocation := filepath.Join(dir, "api.yaml")
+	frontendLocation := filepath.Join(dir, "frontend.yaml")
+	adminLocation := filepath.Join(dir, "admin.yaml")
+	require.NoError(t, os.WriteFile(apiLocation, []byte("name: api"), 0644))
+	require.NoError(t, os.WriteFile(frontendLocation, []byte("name: frontend\nenvs:\n- key: API_URL\n  value: ${LIVE_URL_API}"), 0644))
+	require.NoError(t, os.WriteFile(adminLocation, []byte("name: admin"), 0644))
+
+	as := &mockedAppsService{}
+	as.On("List", mock.Anything, mock.Anything).Return([]*godo.App{}, &godo.Response{}, nil)
+	as.On("Create", mock.Anything, mock.MatchedBy(func(req *godo.AppCreateRequest) bool {
+		return req.Spec.Name == "api"
+	})).Return(&godo.App{ID: "api-id", PendingDeployment: &godo.Deployment{ID: "deployment-id"}}, &godo.Response{}, nil)
+	as.On("Create", mock.Anything, mock.MatchedBy(func(req *godo.AppCreateRequest) bool {
+		// The API's live URL got passed into the frontend's spec.
+		return req.Spec.Name == "frontend" && req.Spec.Envs[0].Value == "https://api.example.com"
+	})).Return(&godo.App{ID: "frontend-id", PendingDeployment: &godo.Deployment{ID: "deployment-id"}}, &godo.Response{}, nil)
+	for _, id := range []string{"api-id", "frontend-id"} {
+		as.On("GetLogs", mock.Anything, id, "deployment-id", "", mock.Anything, true, -1).Return(&godo.AppLogs{},
+			&godo.Response{Response: &http.Response{StatusCode: http.StatusBadRequest}}, errors.New("an error"))
+	}
+	as.On("GetDeployment", mock.Anything, "api-id", "deployment-id").Return(&godo.Deployment{
+		Phase: godo.DeploymentPhase_Active,
+	}, &godo.Response{}, nil)
+	as.On("GetDeployment", mock.Anything, "frontend-id", "deployment-id").Return(&godo.Deployment{
+		Phase: godo.DeploymentPhase_Error,
+	}, &godo.Response{}, nil)
+	as.On("Get", mock.Anything, "api-id").Return(&godo.App{ID: "api-id", LiveURL: "https://api.example.com"}, &godo.Response{}, nil)
+	as.On("Get", mock.Anything, "frontend-id").Return(&godo.App{ID: "frontend-id", PendingDeployment: &godo.Deployment{ID: "deployment-id"}}, &godo.Response{}, nil)
+
+	d := &deployer{
+		action: gha.New(gha.WithWriter(io.Discard), gha.WithGetenv(func(string) string { return "" })),
+		apps:   as,
+	}
+
+	results, err := d.deployMany(context.Background(), []*appDeployment{{
+		name:     "api",
+		location: apiLocation,
+	}, {
+		name:      "frontend",
+		location:  frontendLocation,
+		dependsOn: []string{"api"},
+	}, {
+		name:      "admin",
+		location:  adminLocation,
+		dependsOn: []string{"frontend"},
+	}})
+	require.ErrorContains(t, err, "failed to deploy 2 of 3 apps")
+
+	require.Empty(t, results[0].Error)
+	require.Contains(t, results[1].Error, "deployment failed")
+	require.Equal(t, `dependency "frontend" failed to deploy`, results[2].Error)
+	// Apps whose spec wasn't created are keyed by their manifest name.
+	require.Equal(t, "admin", results[2].Name)
+
+	as.AssertExpectations(t)
+}
+
+func TestDeployManyDuplicateNames(t *testing.T) {
+	dir := t.TempDir()
+	fooLocation := filepath.Join(dir, "foo.yaml")
+	otherLocation := filepath.Join(dir, "other.yaml")
+	require.NoError(t, os.WriteFile(fooLocation, []byte("name: foo"), 0644))
+	require.NoError(t, os.WriteFile(otherLocation, []byte("name: foo"), 0644))
+
+	as := &mockedAppsService{}
+	d := &deployer{
+		action: gha.New(gha.WithWriter(io.Discard), gha.WithGetenv(func(string) string { return "" })),
+		apps:   as,
+	}
+
+	_, err := d.deployMany(context.Background(), deploymentsFromLocations([]string{fooLocation, otherLocation}))
+	require.EqualError(t, err, `app specs `+fooLocation+` and `+otherLocation+` both define app "foo"`)
+	// Nothing was deployed.
+	as.AssertExpectations(t)
+}
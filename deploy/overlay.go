@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+
+	"sigs.k8s.io/yaml"
+)
+
+// overlayListKeys maps lists in the app spec that are merged item by item to the
+// field identifying their items. All other lists are replaced by the overlay.
+var overlayListKeys = map[string]string{
+	"services":     "name",
+	"workers":      "name",
+	"jobs":         "name",
+	"static_sites": "name",
+	"databases":    "name",
+	"functions":    "name",
+	"envs":         "key",
+	"routes":       "path",
+	"domains":      "domain",
+}
+
+const (
+	// overlayPatchKey is the field of an overlay list item that controls how it's merged.
+	overlayPatchKey = "$patch"
+	// overlayPatchDelete removes the matching item from the base list.
+	overlayPatchDelete = "delete"
+)
+
+// mergeSpecOverlay merges the given overlay into the given base app spec and
+// returns the resulting app spec.
+//
+// Mappings are merged recursively and a null value removes the field. Components
+// are merged by name, envs by key, routes by path and domains by domain. Items
+// not in the base are appended and items with "$patch: delete" are removed.
+// All other values, including other lists, are replaced.
+func mergeSpecOverlay(base, overlay []byte) ([]byte, error) {
+	var baseSpec, overlaySpec map[string]any
+	if err := yaml.Unmarshal(base, &baseSpec); err != nil {
+		return nil, fmt.Errorf("failed to parse app spec: %w", err)
+	}
+	if err := yaml.Unmarshal(overlay, &overlaySpec); err != nil {
+		return nil, fmt.Errorf("failed to parse overlay: %w", err)
+	}
+
+	merged, err := mergeOverlayMaps(baseSpec, overlaySpec)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(merged)
+}
+
+// mergeOverlayMaps merges the overlay mapping into the base mapping.
+func mergeOverlayMaps(base, overlay map[string]any) (map[string]any, error) {
+	merged := make(map[string]any, len(base)+len(overlay))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range overlay {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		value, err := mergeOverlayValue(k, merged[k], v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		merged[k] = value
+	}
+	return merged, nil
+}
+
+// mergeOverlayValue merges the overlay value of the given field into the base value.
+func mergeOverlayValue(field string, base, overlay any) (any, error) {
+	switch o := overlay.(type) {
+	case map[string]any:
+		if b, ok := base.(map[string]any); ok {
+			return mergeOverlayMaps(b, o)
+		}
+	case []any:
+		key, ok := overlayListKeys[field]
+		if !ok {
+			break
+		}
+		b, ok := base.([]any)
+		if !ok && base != nil {
+			break
+		}
+		return mergeOverlayList(key, b, o)
+	}
+	return overlay, nil
+}
+
+// mergeOverlayList merges the overlay list into the base list, matching items by
+// the given key.
+func mergeOverlayList(key string, base, overlay []any) ([]any, error) {
+	merged := append([]any{}, base...)
+	for i, item := range overlay {
+		o, ok := item.(map[string]any)
+		if !ok || o[key] == nil {
+			return nil, fmt.Errorf("item %d must define %q", i, key)
+		}
+
+		patch := o[overlayPatchKey]
+		if patch != nil && patch != overlayPatchDelete {
+			return nil, fmt.Errorf("item %d: unsupported %s %v", i, overlayPatchKey, patch)
+		}
+
+		idx := -1
+		for j, b := range merged {
+			if b, ok := b.(map[string]any); ok && reflect.DeepEqual(b[key], o[key]) {
+				idx = j
+				break
+			}
+		}
+
+		switch {
+		case patch == overlayPatchDelete:
+			if idx >= 0 {
+				merged = append(merged[:idx], merged[idx+1:]...)
+			}
+		case idx >= 0:
+			value, err := mergeOverlayMaps(merged[idx].(map[string]any), o)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", o[key], err)
+			}
+			merged[idx] = value
+		default:
+			merged = append(merged, o)
+		}
+	}
+	return merged, nil
+}
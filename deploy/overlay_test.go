@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/digitalocean/godo"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+)
+
+func TestMergeSpecOverlay(t *testing.T) {
+	base := `name: app
+region: nyc
+domains:
+- domain: example.com
+  type: PRIMARY
+envs:
+- key: LOG_LEVEL
+  value: info
+services:
+- name: web
+  instance_count: 1
+  instance_size_slug: basic-xxs
+  envs:
+  - key: STAGE
+    value: base
+  - key: DEBUG
+    value: "true"
+  routes:
+  - path: /
+  health_check:
+    http_path: /healthz
+- name: admin
+  instance_count: 1
+`
+	tests := []struct {
+		name     string
+		overlay  string
+		expected string
+		err      string
+	}{{
+		name: "merge",
+		overlay: `name: app-prod
+domains:
+- domain: example.com
+  type: ALIAS
+- domain: prod.example.com
+  type: PRIMARY
+services:
+- name: web
+  instance_count: 3
+  envs:
+  - key: STAGE
+    value: production
+  - key: DEBUG
+    $patch: delete
+  - key: EXTRA
+    value: "1"
+  routes:
+  - path: /api
+  health_check: null
+- name: admin
+  $patch: delete
+workers:
+- name: worker
+`,
+		expected: `name: app-prod
+region: nyc
+domains:
+- domain: example.com
+  type: ALIAS
+- domain: prod.example.com
+  type: PRIMARY
+envs:
+- key: LOG_LEVEL
+  value: info
+services:
+- name: web
+  instance_count: 3
+  instance_size_slug: basic-xxs
+  envs:
+  - key: STAGE
+    value: production
+  - key: EXTRA
+    value: "1"
+  routes:
+  - path: /
+  - path: /api
+workers:
+- name: worker
+`,
+	}, {
+		name: "replace other lists",
+		overlay: `alerts:
+- rule: DEPLOYMENT_FAILED
+`,
+		expected: base + `alerts:
+- rule: DEPLOYMENT_FAILED
+`,
+	}, {
+		name: "missing key",
+		overlay: `services:
+- instance_count: 2
+`,
+		err: `services: item 0 must define "name"`,
+	}, {
+		name: "unsupported patch",
+		overlay: `services:
+- name: web
+  $patch: replace
+`,
+		err: "services: item 0: unsupported $patch replace",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := mergeSpecOverlay([]byte(base), []byte(test.overlay))
+			if test.err != "" {
+				require.ErrorContains(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+
+			var gotSpec, expectedSpec godo.AppSpec
+			require.NoError(t, yaml.Unmarshal(got, &gotSpec))
+			require.NoError(t, yaml.Unmarshal([]byte(test.expected), &expectedSpec))
+			require.Equal(t, expectedSpec, gotSpec)
+		})
+	}
+}
+
+func TestCreateSpecWithOverlay(t *testing.T) {
+	dir := t.TempDir()
+	specFilePath := filepath.Join(dir, "app.yaml")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "overlays"), 0755))
+	require.NoError(t, os.WriteFile(specFilePath, []byte(`name: app
+services:
+- name: web
+  image:
+    registry_type: DOCKER_HUB
+    repository: nginx
+    tag: latest
+`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "overlays", "staging.yaml"), []byte(`name: app-${STAGE}
+services:
+- name: web
+  instance_count: 2
+`), 0644))
+	t.Setenv("STAGE", "staging")
+
+	d := &deployer{inputs: inputs{appSpecLocation: specFilePath, environment: "staging"}}
+	got, err := d.createSpec(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, &godo.AppSpec{
+		Name: "app-staging",
+		Services: []*godo.AppServiceSpec{{
+			Name:          "web",
+			InstanceCount: 2,
+			Image: &godo.ImageSourceSpec{
+				RegistryType: godo.ImageSourceSpecRegistryType_DockerHub,
+				Repository:   "nginx",
+				Tag:          "latest",
+			},
+		}},
+	}, got)
+
+	d = &deployer{inputs: inputs{appSpecLocation: specFilePath, environment: "production"}}
+	_, err = d.createSpec(context.Background())
+	require.ErrorContains(t, err, `failed to read overlay for environment "production"`)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/digitalocean/app_action/utils"
+	"github.com/digitalocean/godo"
+)
+
+const (
+	// defaultPollInterval is the interval between polls if not configured otherwise.
+	defaultPollInterval = 2 * time.Second
+	// maxPollInterval is the longest interval polling backs off to while the
+	// polled state doesn't change.
+	maxPollInterval = 30 * time.Second
+	// pollBackoffAfter is how long the polled state has to stay unchanged before
+	// polling backs off.
+	pollBackoffAfter = time.Minute
+	// pollBackoffFactor is the factor the interval grows by with every unchanged
+	// poll after pollBackoffAfter.
+	pollBackoffFactor = 1.5
+	// rateLimitReserve is the share of the API's rate limit below which polling
+	// slows down, leaving room for concurrent workflows sharing the token.
+	rateLimitReserve = 0.25
+)
+
+// poller paces a polling loop. It polls at the base interval, backs off while the
+// polled state doesn't change and slows down as the API's rate limit runs low.
+type poller struct {
+	d *deployer
+	// base is the interval between polls while the polled state changes.
+	base time.Duration
+	// interval is the current interval between polls, excluding throttling.
+	interval time.Duration
+	// unchangedSince is when the polled state last changed. It's set by the first
+	// wait, so it's based on now.
+	unchangedSince time.Time
+	// throttled is true while polling is slowed down due to the rate limit.
+	throttled bool
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// newPoller returns a poller polling at the configured interval.
+func (d *deployer) newPoller() *poller {
+	base := d.inputs.pollInterval
+	if base <= 0 {
+		base = defaultPollInterval
+	}
+	return &poller{d: d, base: base, interval: base, now: time.Now, sleep: utils.SleepContext}
+}
+
+// wait waits before the next poll. resp is the API's response to the last poll,
+// if any, and changed is whether the last poll observed a change.
+func (p *poller) wait(ctx context.Context, resp *godo.Response, changed bool) error {
+	now := p.now()
+	if p.unchangedSince.IsZero() {
+		p.unchangedSince = now
+	}
+	if changed {
+		p.interval = p.base
+		p.unchangedSince = now
+	} else if now.Sub(p.unchangedSince) > pollBackoffAfter {
+		p.interval = min(time.Duration(float64(p.interval)*pollBackoffFactor), max(maxPollInterval, p.base))
+	}
+
+	delay := p.interval
+	if throttled := p.rateLimitDelay(resp, now); throttled > delay {
+		if !p.throttled {
+			p.d.action.Infof("API rate limit is running low (%d of %d requests left until %s), polling every %s", resp.Rate.Remaining, resp.Rate.Limit, resp.Rate.Reset.Format(time.TimeOnly), throttled.Round(time.Second))
+			p.throttled = true
+		}
+		delay = throttled
+	} else if p.throttled && resp != nil && resp.Rate.Limit > 0 {
+		p.d.action.Infof("API rate limit recovered, polling every %s", delay.Round(time.Second))
+		p.throttled = false
+	}
+	return p.sleep(ctx, delay)
+}
+
+// rateLimitDelay returns the delay between polls that spreads the requests left
+// in the current rate limit window over the rest of the window, once less than
+// rateLimitReserve of the limit is left. It returns 0 if the rate limit is not
+// running low or unknown.
+func (p *poller) rateLimitDelay(resp *godo.Response, now time.Time) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	rate := resp.Rate
+	if rate.Limit <= 0 || float64(rate.Remaining) >= float64(rate.Limit)*rateLimitReserve {
+		return 0
+	}
+	untilReset := rate.Reset.Sub(now)
+	if untilReset <= 0 {
+		return 0
+	}
+	if rate.Remaining <= 0 {
+		return untilReset
+	}
+	// The closer the budget gets to 0, the larger the share of the window
+	// each request gets.
+	return untilReset / time.Duration(rate.Remaining)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+	gha "github.com/sethvargo/go-githubactions"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoller(t *testing.T) {
+	ctx := context.Background()
+	var actionLogs bytes.Buffer
+	d := &deployer{action: gha.New(gha.WithWriter(&actionLogs)), inputs: inputs{pollInterval: 5 * time.Second}}
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var delays []time.Duration
+	p := d.newPoller()
+	p.now = func() time.Time { return now }
+	p.sleep = func(_ context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		now = now.Add(d)
+		return nil
+	}
+	plenty := &godo.Response{Rate: godo.Rate{Limit: 5000, Remaining: 4000, Reset: godo.Timestamp{Time: now.Add(time.Hour)}}}
+
+	// Polls at the base interval while the state is unchanged for up to a minute.
+	for range 12 {
+		require.NoError(t, p.wait(ctx, plenty, false))
+	}
+	require.Equal(t, 5*time.Second, delays[len(delays)-1])
+
+	// Backs off afterwards, up to the maximum.
+	for range 10 {
+		require.NoError(t, p.wait(ctx, plenty, false))
+	}
+	require.Equal(t, 7500*time.Millisecond, delays[13])
+	require.Equal(t, maxPollInterval, delays[len(delays)-1])
+
+	// A change resets the interval.
+	require.NoError(t, p.wait(ctx, plenty, true))
+	require.Equal(t, 5*time.Second, delays[len(delays)-1])
+
+	// Slows down if the rate limit runs low.
+	low := &godo.Response{Rate: godo.Rate{Limit: 5000, Remaining: 100, Reset: godo.Timestamp{Time: now.Add(time.Hour)}}}
+	require.NoError(t, p.wait(ctx, low, true))
+	require.Equal(t, 36*time.Second, delays[len(delays)-1])
+	require.NoError(t, p.wait(ctx, low, true))
+
+	// Waits for the reset if the rate limit is used up.
+	exhausted := &godo.Response{Rate: godo.Rate{Limit: 5000, Remaining: 0, Reset: godo.Timestamp{Time: now.Add(time.Minute)}}}
+	require.NoError(t, p.wait(ctx, exhausted, true))
+	require.Equal(t, time.Minute, delays[len(delays)-1])
+
+	require.NoError(t, p.wait(ctx, plenty, true))
+	require.Equal(t, 5*time.Second, delays[len(delays)-1])
+
+	require.Equal(t, `API rate limit is running low (100 of 5000 requests left until 13:04:40), polling every 36s
+API rate limit recovered, polling every 5s
+`, actionLogs.String())
+}
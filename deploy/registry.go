@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/digitalocean/godo"
+)
+
+// docrUsername is the username to log in to DOCR with. DOCR only checks the
+// password, which is the DigitalOcean token.
+const docrUsername = "do-app-action"
+
+// Hosts of the registries images can be deployed from.
+const (
+	docrHost      = "registry.digitalocean.com"
+	ghcrHost      = "ghcr.io"
+	dockerHubHost = "registry-1.docker.io"
+)
+
+// manifestMediaTypes are the media types of the manifests images might have.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// challengeParamRegex matches the parameters of a WWW-Authenticate challenge, like
+// `realm="https://ghcr.io/token"`.
+var challengeParamRegex = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// errManifestNotFound is returned if the manifest of an image doesn't exist.
+var errManifestNotFound = errors.New("manifest not found")
+
+// registryImage is an image as addressed by the OCI distribution API.
+type registryImage struct {
+	// Host is the host of the registry, like "ghcr.io".
+	Host string
+	// Name is the name of the repository in the registry, like "org/repo".
+	Name string
+	// Reference is the tag or digest of the image.
+	Reference string
+	// Username and Password authenticate against the registry, if set.
+	Username string
+	Password string
+}
+
+// String returns the image in the usual `host/name:tag` notation.
+func (i registryImage) String() string {
+	if strings.Contains(i.Reference, ":") {
+		return i.Host + "/" + i.Name + "@" + i.Reference
+	}
+	return i.Host + "/" + i.Name + ":" + i.Reference
+}
+
+// registryImageFromSpec returns where the given image can be found via the OCI
+// distribution API. DOCR is authenticated with the given DigitalOcean token,
+// other registries with the image's registry credentials if any.
+func registryImageFromSpec(image *godo.ImageSourceSpec, doToken string) (registryImage, error) {
+	img := registryImage{Reference: image.GetDigest()}
+	if img.Reference == "" {
+		img.Reference = image.GetTag()
+	}
+	if img.Reference == "" {
+		img.Reference = "latest"
+	}
+
+	switch image.GetRegistryType() {
+	case godo.ImageSourceSpecRegistryType_DOCR:
+		if image.GetRegistry() == "" {
+			return img, fmt.Errorf("the registry of DOCR image %q must be set to look it up", image.GetRepository())
+		}
+		img.Host = docrHost
+		img.Name = image.GetRegistry() + "/" + image.GetRepository()
+		img.Username, img.Password = docrUsername, doToken
+	case godo.ImageSourceSpecRegistryType_Ghcr:
+		img.Host = ghcrHost
+		img.Name = image.GetRegistry() + "/" + image.GetRepository()
+		img.Username, img.Password, _ = strings.Cut(image.GetRegistryCredentials(), ":")
+	case godo.ImageSourceSpecRegistryType_DockerHub:
+		registry := image.GetRegistry()
+		if registry == "" {
+			// Official images live in the "library" namespace.
+			registry = "library"
+		}
+		img.Host = dockerHubHost
+		img.Name = registry + "/" + image.GetRepository()
+		img.Username, img.Password, _ = strings.Cut(image.GetRegistryCredentials(), ":")
+	default:
+		return img, fmt.Errorf("unsupported registry type %q", image.GetRegistryType())
+	}
+	return img, nil
+}
+
+// registryImage returns where the given image can be found, like
+// registryImageFromSpec. DOCR images without a registry are looked up in the
+// account's registry, like App Platform does.
+func (d *deployer) registryImage(ctx context.Context, image *godo.ImageSourceSpec) (registryImage, error) {
+	if image.GetRegistryType() == godo.ImageSourceSpecRegistryType_DOCR && image.GetRegistry() == "" {
+		registry, _, err := d.docr.Get(ctx)
+		if err != nil {
+			return registryImage{}, fmt.Errorf("failed to get the account's container registry: %w", err)
+		}
+		withRegistry := *image
+		withRegistry.Registry = registry.Name
+		image = &withRegistry
+	}
+	return registryImageFromSpec(image, d.inputs.token)
+}
+
+// registryClient queries container registries via the OCI distribution API.
+type registryClient struct {
+	httpClient *http.Client
+}
+
+// manifestDigest returns the digest of the given image's manifest. If the manifest
+// doesn't exist, an error wrapping errManifestNotFound is returned.
+func (c *registryClient) manifestDigest(ctx context.Context, img registryImage) (string, error) {
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", img.Host, img.Name, img.Reference)
+	resp, err := c.authorizedRequest(ctx, http.MethodHead, manifestURL, img)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if err := checkManifestResponse(resp, img); err != nil {
+		return "", err
+	}
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+
+	// Not all registries return the digest, so fall back to hashing the manifest.
+	resp, err = c.authorizedRequest(ctx, http.MethodGet, manifestURL, img)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := checkManifestResponse(resp, img); err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, resp.Body); err != nil {
+		return "", fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checkManifestResponse checks the response of a manifest request for errors.
+func checkManifestResponse(resp *http.Response, img registryImage) error {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %s", errManifestNotFound, img)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("access to %s denied, check the registry credentials", img)
+	default:
+		return fmt.Errorf("unexpected status %d for %s", resp.StatusCode, img)
+	}
+}
+
+// authorizedRequest sends a request to the registry. If the registry challenges
+// the request, it's retried with the authorization the challenge asks for.
+func (c *registryClient) authorizedRequest(ctx context.Context, method, manifestURL string, img registryImage) (*http.Response, error) {
+	resp, err := c.request(ctx, method, manifestURL, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	scheme, params, _ := strings.Cut(resp.Header.Get("WWW-Authenticate"), " ")
+	var authorization string
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if img.Username == "" {
+			return resp, nil
+		}
+		authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(img.Username+":"+img.Password))
+	case "bearer":
+		token, err := c.token(ctx, params, img)
+		if err != nil {
+			return nil, err
+		}
+		authorization = "Bearer " + token
+	default:
+		return resp, nil
+	}
+	return c.request(ctx, method, manifestURL, authorization)
+}
+
+// request sends a request for a manifest with the given authorization, if any.
+func (c *registryClient) request(ctx context.Context, method, manifestURL, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, manifestURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query registry: %w", err)
+	}
+	return resp, nil
+}
+
+// token fetches a bearer token as asked for by the given challenge parameters.
+// Without credentials, an anonymous token is requested.
+func (c *registryClient) token(ctx context.Context, challenge string, img registryImage) (string, error) {
+	params := make(map[string]string)
+	for _, m := range challengeParamRegex.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Scheme == "" {
+		return "", fmt.Errorf("invalid authentication realm %q", params["realm"])
+	}
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + img.Name + ":pull"
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	if img.Username != "" {
+		req.SetBasicAuth(img.Username, img.Password)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get registry token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get registry token for %s: unexpected status %d", img, resp.StatusCode)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode registry token: %w", err)
+	}
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	return token.AccessToken, nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/godo"
+	gha "github.com/sethvargo/go-githubactions"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRegistry serves manifests and tokens like a registry with token
+// authentication. Manifests are keyed by "host/name:reference".
+type fakeRegistry struct {
+	manifests map[string]string
+	// omitDigest omits the digest header, like some registries do.
+	omitDigest bool
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *fakeRegistry) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	switch {
+	case req.URL.Path == "/token":
+		if req.URL.Query().Get("scope") == "" {
+			rec.WriteHeader(http.StatusBadRequest)
+			break
+		}
+		rec.WriteString(`{"token": "secret-token"}`)
+	case req.Header.Get("Authorization") != "Bearer secret-token":
+		rec.Header().Set("WWW-Authenticate", `Bearer realm="https://`+req.URL.Host+`/token",service="`+req.URL.Host+`"`)
+		rec.WriteHeader(http.StatusUnauthorized)
+	default:
+		path := strings.TrimPrefix(req.URL.Path, "/v2/")
+		i := strings.LastIndex(path, "/manifests/")
+		name, ref := path[:i], path[i+len("/manifests/"):]
+		manifest, ok := r.manifests[req.URL.Host+"/"+name+":"+ref]
+		if !ok {
+			rec.WriteHeader(http.StatusNotFound)
+			break
+		}
+		if !r.omitDigest {
+			rec.Header().Set("Docker-Content-Digest", "sha256:from-header")
+		}
+		if req.Method == http.MethodGet {
+			rec.WriteString(manifest)
+		}
+	}
+	return rec.Result(), nil
+}
+
+func TestRegistryImageFromSpec(t *testing.T) {
+	tests := []struct {
+		name     string
+		image    *godo.ImageSourceSpec
+		expected registryImage
+		err      bool
+	}{{
+		name: "docr",
+		image: &godo.ImageSourceSpec{
+			RegistryType: godo.ImageSourceSpecRegistryType_DOCR,
+			Registry:     "my-registry",
+			Repository:   "web",
+			Tag:          "v1",
+		},
+		expected: registryImage{Host: docrHost, Name: "my-registry/web", Reference: "v1", Username: docrUsername, Password: "do-token"},
+	}, {
+		name: "docr without registry",
+		image: &godo.ImageSourceSpec{
+			RegistryType: godo.ImageSourceSpecRegistryType_DOCR,
+			Repository:   "web",
+		},
+		err: true,
+	}, {
+		name: "ghcr with credentials",
+		image: &godo.ImageSourceSpec{
+			RegistryType:        godo.ImageSourceSpecRegistryType_Ghcr,
+			Registry:            "org",
+			Repository:          "web",
+			Digest:              "sha256:abcd",
+			RegistryCredentials: "user:pass",
+		},
+		expected: registryImage{Host: ghcrHost, Name: "org/web", Reference: "sha256:abcd", Username: "user", Password: "pass"},
+	}, {
+		name: "official docker hub image",
+		image: &godo.ImageSourceSpec{
+			RegistryType: godo.ImageSourceSpecRegistryType_DockerHub,
+			Repository:   "nginx",
+		},
+		expected: registryImage{Host: dockerHubHost, Name: "library/nginx", Reference: "latest"},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := registryImageFromSpec(test.image, "do-token")
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, got)
+		})
+	}
+}
+
+func TestManifestDigest(t *testing.T) {
+	ctx := context.Background()
+	registry := &fakeRegistry{manifests: map[string]string{
+		"ghcr.io/org/web:v1": `{"schemaVersion": 2}`,
+	}}
+	c := &registryClient{httpClient: &http.Client{Transport: registry}}
+
+	got, err := c.manifestDigest(ctx, registryImage{Host: ghcrHost, Name: "org/web", Reference: "v1"})
+	require.NoError(t, err)
+	require.Equal(t, "sha256:from-header", got)
+
+	// Without the header, the manifest is hashed.
+	registry.omitDigest = true
+	got, err = c.manifestDigest(ctx, registryImage{Host: ghcrHost, Name: "org/web", Reference: "v1"})
+	require.NoError(t, err)
+	sum := sha256.Sum256([]byte(`{"schemaVersion": 2}`))
+	require.Equal(t, "sha256:"+hex.EncodeToString(sum[:]), got)
+
+	_, err = c.manifestDigest(ctx, registryImage{Host: ghcrHost, Name: "org/web", Reference: "v2"})
+	require.True(t, errors.Is(err, errManifestNotFound))
+	require.EqualError(t, err, "manifest not found: ghcr.io/org/web:v2")
+}
+
+type mockedRegistryService struct {
+	mock.Mock
+	godo.RegistryService
+}
+
+func (m *mockedRegistryService) Get(ctx context.Context) (*godo.Registry, *godo.Response, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(*godo.Registry), args.Get(1).(*godo.Response), args.Error(2)
+}
+
+func TestResolveImageDigests(t *testing.T) {
+	spec := &godo.AppSpec{
+		Services: []*godo.AppServiceSpec{{
+			Name: "web",
+			Image: &godo.ImageSourceSpec{
+				RegistryType: godo.ImageSourceSpecRegistryType_Ghcr,
+				Registry:     "org",
+				Repository:   "web",
+				Tag:          "v1",
+			},
+		}},
+		Workers: []*godo.AppWorkerSpec{{
+			Name: "worker",
+			Image: &godo.ImageSourceSpec{
+				RegistryType: godo.ImageSourceSpecRegistryType_DockerHub,
+				Repository:   "worker",
+				Digest:       "sha256:pinned",
+			},
+		}},
+		Jobs: []*godo.AppJobSpec{{
+			Name: "migrate",
+			Image: &godo.ImageSourceSpec{
+				// The registry defaults to the account's registry.
+				RegistryType: godo.ImageSourceSpecRegistryType_DOCR,
+				Repository:   "migrate",
+				Tag:          "v1",
+			},
+		}},
+	}
+
+	docr := &mockedRegistryService{}
+	docr.On("Get", mock.Anything).Return(&godo.Registry{Name: "my-registry"}, &godo.Response{}, nil)
+	d := &deployer{
+		action: gha.New(gha.WithWriter(io.Discard)),
+		docr:   docr,
+		httpClient: &http.Client{Transport: &fakeRegistry{manifests: map[string]string{
+			"ghcr.io/org/web:v1": `{"schemaVersion": 2}`,
+			"registry.digitalocean.com/my-registry/migrate:v1": `{"schemaVersion": 2}`,
+		}}},
+	}
+	got, err := d.resolveImageDigests(context.Background(), spec)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"web": "sha256:from-header", "migrate": "sha256:from-header"}, got)
+	require.Empty(t, spec.Jobs[0].Image.Registry)
+	require.Equal(t, &godo.ImageSourceSpec{
+		RegistryType: godo.ImageSourceSpecRegistryType_Ghcr,
+		Registry:     "org",
+		Repository:   "web",
+		Digest:       "sha256:from-header", // Tag was replaced with the digest.
+	}, spec.Services[0].Image)
+	require.Equal(t, "sha256:pinned", spec.Workers[0].Image.Digest)
+}
+
+func TestCheckImagesExist(t *testing.T) {
+	spec := &godo.AppSpec{
+		Services: []*godo.AppServiceSpec{{
+			Name: "web",
+			Image: &godo.ImageSourceSpec{
+				RegistryType: godo.ImageSourceSpecRegistryType_Ghcr,
+				Registry:     "org",
+				Repository:   "web",
+				Tag:          "v1",
+			},
+		}, {
+			Name: "api",
+			Image: &godo.ImageSourceSpec{
+				RegistryType: godo.ImageSourceSpecRegistryType_Ghcr,
+				Registry:     "org",
+				Repository:   "api",
+				Tag:          "typo",
+			},
+		}},
+		Workers: []*godo.AppWorkerSpec{{
+			Name: "worker",
+			Image: &godo.ImageSourceSpec{
+				RegistryType: godo.ImageSourceSpecRegistryType_DockerHub,
+				Repository:   "worker",
+				Digest:       "sha256:abcd",
+			},
+		}},
+	}
+
+	registry := &fakeRegistry{manifests: map[string]string{
+		"ghcr.io/org/web:v1":                              `{}`,
+		"registry-1.docker.io/library/worker:sha256:abcd": `{}`,
+	}}
+	d := &deployer{httpClient: &http.Client{Transport: registry}}
+	err := d.checkImagesExist(context.Background(), spec)
+	require.EqualError(t, err, `component "api": image ghcr.io/org/api:typo does not exist`)
+
+	registry.manifests["ghcr.io/org/api:typo"] = `{}`
+	require.NoError(t, d.checkImagesExist(context.Background(), spec))
+}
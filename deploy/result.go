@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/digitalocean/godo"
+	gha "github.com/sethvargo/go-githubactions"
+)
+
+// deployResult is the result of deploying an app.
+type deployResult struct {
+	// App is the app after the deployment.
+	App *godo.App
+	// Deployment is the deployment that was waited for.
+	Deployment *godo.Deployment
+	// Created is true if the app was created rather than updated.
+	Created bool
+	// Skipped is true if the app was unchanged and thus not deployed. Deployment
+	// is the active deployment then.
+	Skipped bool
+	// BuildLogs are the build logs of the deployment.
+	BuildLogs []byte
+	// DeployLogs are the deploy logs of the deployment.
+	DeployLogs []byte
+}
+
+// componentResult describes how a component of an app can be reached.
+type componentResult struct {
+	Type   godo.AppComponentType `json:"type"`
+	URLs   []string              `json:"urls,omitempty"`
+	Routes []string              `json:"routes,omitempty"`
+}
+
+// components returns how each of the app's components can be reached, keyed by
+// the component's name.
+func (r *deployResult) components() map[string]*componentResult {
+	spec := r.App.GetSpec()
+	if spec == nil {
+		return nil
+	}
+
+	// Routes can be defined via ingress rules or (deprecated) on the components.
+	routes := make(map[string][]string)
+	for _, rule := range spec.GetIngress().GetRules() {
+		component := rule.GetComponent().GetName()
+		prefix := rule.GetMatch().GetPath().GetPrefix()
+		if component == "" || prefix == "" {
+			continue
+		}
+		routes[component] = append(routes[component], prefix)
+	}
+
+	components := make(map[string]*componentResult)
+	_ = spec.ForEachAppComponentSpec(func(c godo.AppComponentSpec) error {
+		res := &componentResult{Type: c.GetType(), Routes: routes[c.GetName()]}
+		if rc, ok := c.(godo.AppRoutableComponentSpec); ok {
+			for _, route := range rc.GetRoutes() {
+				if route.GetPath() != "" {
+					res.Routes = append(res.Routes, route.GetPath())
+				}
+			}
+		}
+		sort.Strings(res.Routes)
+
+		if liveURL := r.App.GetLiveURL(); liveURL != "" {
+			for _, route := range res.Routes {
+				res.URLs = append(res.URLs, strings.TrimSuffix(liveURL, "/")+route)
+			}
+		}
+		components[c.GetName()] = res
+		return nil
+	})
+	return components
+}
+
+// setOutputs sets the action's outputs from the result.
+func (r *deployResult) setOutputs(a *gha.Action) error {
+	// Secrets that weren't encrypted by the API must not end up in the output.
+	app, err := scrubSecrets(r.App)
+	if err != nil {
+		return fmt.Errorf("failed to scrub secrets from app: %w", err)
+	}
+	appJSON, err := json.Marshal(app)
+	if err != nil {
+		return fmt.Errorf("failed to marshal app: %w", err)
+	}
+	componentsJSON, err := json.Marshal(r.components())
+	if err != nil {
+		return fmt.Errorf("failed to marshal components: %w", err)
+	}
+
+	a.SetOutput("app", string(appJSON))
+	a.SetOutput("app_id", r.App.GetID())
+	a.SetOutput("live_url", r.App.GetLiveURL())
+	a.SetOutput("default_ingress", r.App.GetDefaultIngress())
+	a.SetOutput("deployment_id", r.Deployment.GetID())
+	a.SetOutput("deployment_phase", string(r.Deployment.GetPhase()))
+	a.SetOutput("deployment_cause", r.Deployment.GetCause())
+	a.SetOutput("components", string(componentsJSON))
+	a.SetOutput("created", strconv.FormatBool(r.Created))
+	a.SetOutput("skipped", strconv.FormatBool(r.Skipped))
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/digitalocean/godo"
+	gha "github.com/sethvargo/go-githubactions"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeployResultComponents(t *testing.T) {
+	res := &deployResult{
+		App: &godo.App{
+			LiveURL: "https://example.com",
+			Spec: &godo.AppSpec{
+				Services: []*godo.AppServiceSpec{{
+					Name:   "api",
+					Routes: []*godo.AppRouteSpec{{Path: "/v1"}},
+				}},
+				StaticSites: []*godo.AppStaticSiteSpec{{
+					Name: "frontend",
+				}},
+				Workers: []*godo.AppWorkerSpec{{
+					Name: "worker",
+				}},
+				Ingress: &godo.AppIngressSpec{
+					Rules: []*godo.AppIngressSpecRule{{
+						Match:     &godo.AppIngressSpecRuleMatch{Path: &godo.AppIngressSpecRuleStringMatch{Prefix: "/api"}},
+						Component: &godo.AppIngressSpecRuleRoutingComponent{Name: "api"},
+					}, {
+						Match:     &godo.AppIngressSpecRuleMatch{Path: &godo.AppIngressSpecRuleStringMatch{Prefix: "/"}},
+						Component: &godo.AppIngressSpecRuleRoutingComponent{Name: "frontend"},
+					}, {
+						Match:    &godo.AppIngressSpecRuleMatch{Path: &godo.AppIngressSpecRuleStringMatch{Prefix: "/old"}},
+						Redirect: &godo.AppIngressSpecRuleRoutingRedirect{Uri: "/new"},
+					}},
+				},
+			},
+		},
+	}
+
+	require.Equal(t, map[string]*componentResult{
+		"api": {
+			Type:   godo.AppComponentTypeService,
+			URLs:   []string{"https://example.com/api", "https://example.com/v1"},
+			Routes: []string{"/api", "/v1"},
+		},
+		"frontend": {
+			Type:   godo.AppComponentTypeStaticSite,
+			URLs:   []string{"https://example.com/"},
+			Routes: []string{"/"},
+		},
+		"worker": {
+			Type: godo.AppComponentTypeWorker,
+		},
+	}, res.components())
+}
+
+func TestDeployResultSetOutputs(t *testing.T) {
+	outputFilePath := t.TempDir() + "/output"
+	a := gha.New(gha.WithGetenv(func(k string) string {
+		if k == "GITHUB_OUTPUT" {
+			return outputFilePath
+		}
+		return ""
+	}))
+
+	res := &deployResult{
+		App: &godo.App{
+			ID:             "app-id",
+			LiveURL:        "https://example.com",
+			DefaultIngress: "https://foo.ondigitalocean.app",
+			Spec:           &godo.AppSpec{Name: "foo"},
+		},
+		Deployment: &godo.Deployment{
+			ID:    "deployment-id",
+			Phase: godo.DeploymentPhase_Active,
+			Cause: "manual",
+		},
+		Created: true,
+	}
+	require.NoError(t, res.setOutputs(a))
+
+	output, err := os.ReadFile(outputFilePath)
+	require.NoError(t, err)
+	require.Equal(t, `app<<_GitHubActionsFileCommandDelimeter_
+{"id":"app-id","spec":{"name":"foo"},"last_deployment_active_at":"0001-01-01T00:00:00Z","default_ingress":"https://foo.ondigitalocean.app","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z","last_deployment_created_at":"0001-01-01T00:00:00Z","live_url":"https://example.com"}
+_GitHubActionsFileCommandDelimeter_
+app_id<<_GitHubActionsFileCommandDelimeter_
+app-id
+_GitHubActionsFileCommandDelimeter_
+live_url<<_GitHubActionsFileCommandDelimeter_
+https://example.com
+_GitHubActionsFileCommandDelimeter_
+default_ingress<<_GitHubActionsFileCommandDelimeter_
+https://foo.ondigitalocean.app
+_GitHubActionsFileCommandDelimeter_
+deployment_id<<_GitHubActionsFileCommandDelimeter_
+deployment-id
+_GitHubActionsFileCommandDelimeter_
+deployment_phase<<_GitHubActionsFileCommandDelimeter_
+ACTIVE
+_GitHubActionsFileCommandDelimeter_
+deployment_cause<<_GitHubActionsFileCommandDelimeter_
+manual
+_GitHubActionsFileCommandDelimeter_
+components<<_GitHubActionsFileCommandDelimeter_
+{}
+_GitHubActionsFileCommandDelimeter_
+created<<_GitHubActionsFileCommandDelimeter_
+true
+_GitHubActionsFileCommandDelimeter_
+skipped<<_GitHubActionsFileCommandDelimeter_
+false
+_GitHubActionsFileCommandDelimeter_
+`, string(output))
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/digitalocean/godo"
+	gha "github.com/sethvargo/go-githubactions"
+)
+
+// redactedValue replaces the values of secrets in outputs.
+const redactedValue = "[REDACTED]"
+
+// minLeakCheckLength is the length below which a secret's value is only
+// considered leaked if it makes up a variable's whole value. Shorter values are
+// too likely to be part of unrelated values by chance, like "1" in a port.
+const minLeakCheckLength = 8
+
+// secretRef is a secret to inject into the app spec.
+type secretRef struct {
+	// Component is the component to inject the secret into. It's empty for
+	// app-wide secrets.
+	Component string
+	// Key is the key of the variable in the app spec.
+	Key string
+	// Var is the environment variable holding the secret's value.
+	Var string
+}
+
+// parseSecretRefs parses secret references in the form `[component/]KEY[=VAR]`.
+// If VAR is omitted, the value is read from the environment variable KEY.
+func parseSecretRefs(entries []string) ([]secretRef, error) {
+	refs := make([]secretRef, 0, len(entries))
+	for _, entry := range entries {
+		var ref secretRef
+		target, envVar, hasVar := strings.Cut(entry, "=")
+		if component, key, ok := strings.Cut(target, "/"); ok {
+			ref.Component, ref.Key = component, key
+		} else {
+			ref.Key = target
+		}
+		ref.Var = ref.Key
+		if hasVar {
+			ref.Var = envVar
+		}
+		if ref.Key == "" || ref.Var == "" || (ref.Component == "" && strings.Contains(target, "/")) {
+			return nil, fmt.Errorf("invalid secret %q, expected [component/]KEY[=VAR]", entry)
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// injectSecrets injects the configured secrets into the given app spec as SECRET
+// variables, overriding variables with the same key. The secrets' values are
+// masked in the action's logs. It fails if a secret's value ends up in a variable
+// that is not a SECRET, for example through environment variable expansion.
+// Values shorter than minLeakCheckLength only count if they match a variable's
+// whole value.
+func (d *deployer) injectSecrets(spec *godo.AppSpec) error {
+	values := make(map[string]string, len(d.inputs.secrets))
+	for _, ref := range d.inputs.secrets {
+		value := d.getenv(ref.Var)
+		if value == "" {
+			return fmt.Errorf("secret %q: environment variable %q is not set", ref.Key, ref.Var)
+		}
+		maskValue(d.action.AddMask, value)
+		values[ref.Var] = value
+
+		envs := &spec.Envs
+		if ref.Component != "" {
+			envs = nil
+			_ = spec.ForEachAppComponentSpec(func(c godo.AppComponentSpec) error {
+				if c.GetName() == ref.Component {
+					envs = componentEnvs(c)
+				}
+				return nil
+			})
+			if envs == nil {
+				return fmt.Errorf("secret %q: component %q does not exist or does not support variables", ref.Key, ref.Component)
+			}
+		}
+
+		var env *godo.AppVariableDefinition
+		for _, existing := range *envs {
+			if existing.GetKey() == ref.Key {
+				env = existing
+				break
+			}
+		}
+		if env == nil {
+			env = &godo.AppVariableDefinition{Key: ref.Key}
+			*envs = append(*envs, env)
+		}
+		env.Value = value
+		env.Type = godo.AppVariableType_Secret
+	}
+
+	var err error
+	forEachEnv(spec, func(component string, env *godo.AppVariableDefinition) {
+		if err != nil || env.GetType() == godo.AppVariableType_Secret {
+			return
+		}
+		for _, ref := range d.inputs.secrets {
+			if containsSecret(env.GetValue(), values[ref.Var]) {
+				where := fmt.Sprintf("app-wide variable %q", env.GetKey())
+				if component != "" {
+					where = fmt.Sprintf("variable %q of component %q", env.GetKey(), component)
+				}
+				err = fmt.Errorf("%s contains the value of secret %q but is not of type %s", where, ref.Var, godo.AppVariableType_Secret)
+				return
+			}
+		}
+	})
+	return err
+}
+
+// containsSecret returns whether the given value contains the given secret value,
+// see minLeakCheckLength.
+func containsSecret(value, secret string) bool {
+	if len(secret) < minLeakCheckLength {
+		return value == secret
+	}
+	return strings.Contains(value, secret)
+}
+
+// componentEnvs returns a pointer to the variables of the given component, or
+// nil if the component doesn't support variables.
+func componentEnvs(c godo.AppComponentSpec) *[]*godo.AppVariableDefinition {
+	switch c := c.(type) {
+	case *godo.AppServiceSpec:
+		return &c.Envs
+	case *godo.AppWorkerSpec:
+		return &c.Envs
+	case *godo.AppJobSpec:
+		return &c.Envs
+	case *godo.AppStaticSiteSpec:
+		return &c.Envs
+	case *godo.AppFunctionsSpec:
+		return &c.Envs
+	}
+	return nil
+}
+
+// forEachEnv calls fn for every variable of the app and its components. The
+// component is empty for app-wide variables.
+func forEachEnv(spec *godo.AppSpec, fn func(component string, env *godo.AppVariableDefinition)) {
+	for _, env := range spec.GetEnvs() {
+		fn("", env)
+	}
+	_ = spec.ForEachAppComponentSpec(func(c godo.AppComponentSpec) error {
+		if envs := componentEnvs(c); envs != nil {
+			for _, env := range *envs {
+				fn(c.GetName(), env)
+			}
+		}
+		return nil
+	})
+}
+
+// maskSecrets masks the values of all SECRET variables in the given app spec.
+// Values encrypted by the API are not secret and thus not masked.
+func maskSecrets(a *gha.Action, spec *godo.AppSpec) {
+	forEachEnv(spec, func(_ string, env *godo.AppVariableDefinition) {
+		if env.GetType() == godo.AppVariableType_Secret && !isEncryptedValue(env.GetValue()) {
+			maskValue(a.AddMask, env.GetValue())
+		}
+	})
+}
+
+// scrubSecrets returns a copy of the given app where the values of all SECRET
+// variables that are not encrypted are redacted.
+func scrubSecrets(app *godo.App) (*godo.App, error) {
+	if app == nil {
+		return nil, nil
+	}
+	bs, err := json.Marshal(app)
+	if err != nil {
+		return nil, err
+	}
+	var scrubbed *godo.App
+	if err := json.Unmarshal(bs, &scrubbed); err != nil {
+		return nil, err
+	}
+
+	specs := []*godo.AppSpec{scrubbed.Spec}
+	for _, dep := range []*godo.Deployment{scrubbed.ActiveDeployment, scrubbed.InProgressDeployment, scrubbed.PendingDeployment, scrubbed.PinnedDeployment} {
+		specs = append(specs, dep.GetSpec())
+	}
+	for _, spec := range specs {
+		if spec == nil {
+			continue
+		}
+		forEachEnv(spec, func(_ string, env *godo.AppVariableDefinition) {
+			if env.GetType() == godo.AppVariableType_Secret && env.GetValue() != "" && !isEncryptedValue(env.GetValue()) {
+				env.Value = redactedValue
+			}
+		})
+	}
+	return scrubbed, nil
+}
+
+// carryOverSecrets sets the value of SECRET variables that are empty in the given
+// app spec to their encrypted value in the live app spec, so updating the app
+// doesn't wipe them. It returns the carried over variables, qualified by their
+// component if any.
+func carryOverSecrets(spec, live *godo.AppSpec) []string {
+	encrypted := make(map[string]string)
+	forEachEnv(live, func(component string, env *godo.AppVariableDefinition) {
+		if env.GetType() == godo.AppVariableType_Secret && isEncryptedValue(env.GetValue()) {
+			encrypted[qualifiedEnvKey(component, env.GetKey())] = env.GetValue()
+		}
+	})
+
+	var carried []string
+	forEachEnv(spec, func(component string, env *godo.AppVariableDefinition) {
+		if env.GetValue() != "" || (env.GetType() != "" && env.GetType() != godo.AppVariableType_Secret) {
+			return
+		}
+		key := qualifiedEnvKey(component, env.GetKey())
+		if value, ok := encrypted[key]; ok {
+			env.Value = value
+			env.Type = godo.AppVariableType_Secret
+			carried = append(carried, key)
+		}
+	})
+	return carried
+}
+
+// qualifiedEnvKey qualifies the given variable key with its component, if any.
+func qualifiedEnvKey(component, key string) string {
+	if component == "" {
+		return key
+	}
+	return component + "/" + key
+}
+
+// isEncryptedValue returns whether the given value was encrypted by the API, like
+// "EV[1:abc:def]".
+func isEncryptedValue(value string) bool {
+	return strings.HasPrefix(value, "EV[") && strings.HasSuffix(value, "]")
+}
+
+// maskValue masks the given value line by line, since masks can't span lines.
+func maskValue(mask func(string), value string) {
+	for _, line := range strings.Split(value, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			mask(line)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/digitalocean/godo"
+	gha "github.com/sethvargo/go-githubactions"
+	yamlv3 "sigs.k8s.io/yaml/goyaml.v3"
+)
+
+var (
+	// yamlLineRegex matches the line reported in YAML syntax errors.
+	yamlLineRegex = regexp.MustCompile(`yaml: line (\d+):`)
+	// jsonFieldRegex matches the field reported in JSON decoding errors, like
+	// "Go struct field AppServiceSpec.services.instance_count of type int64".
+	jsonFieldRegex = regexp.MustCompile(`Go struct field \w+\.([\w.]+) of type`)
+	// jsonUnknownFieldRegex matches the field reported for unknown fields.
+	jsonUnknownFieldRegex = regexp.MustCompile(`unknown field "(\w+)"`)
+	// specPathRegex matches paths into the app spec as reported by the API, like
+	// "services[0].routes[0].path" or "services.0.name".
+	specPathRegex = regexp.MustCompile(`\b[a-z_]+(?:\[\d+\])*(?:\.(?:[a-z_]+|\d+)(?:\[\d+\])*)+\b`)
+)
+
+// specError is an error that could be attributed to a position in the app spec file.
+type specError struct {
+	// File is the location of the app spec.
+	File string
+	// Line is the 1-based line of the error.
+	Line int
+	// Column is the 1-based column of the error, or 0 if unknown.
+	Column int
+
+	err error
+}
+
+// Error implements error.
+func (e *specError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *specError) Unwrap() error {
+	return e.err
+}
+
+// locateSpecError tries to attribute the given error to a position in the app spec
+// the deployer created the spec from. If that fails, the error is returned as is.
+// Positions refer to the app spec after environment variable expansion, which
+// matches the file unless variables expand to multiple lines.
+func (d *deployer) locateSpecError(err error) error {
+	if err == nil || len(d.specSource) == 0 || d.specFile == "" {
+		return err
+	}
+
+	var msg string
+	var apiErr *godo.ErrorResponse
+	if errors.As(err, &apiErr) {
+		msg = apiErr.Message
+	} else {
+		msg = err.Error()
+	}
+
+	if m := yamlLineRegex.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return &specError{File: d.specFile, Line: line, err: err}
+	}
+
+	var root yamlv3.Node
+	if yamlv3.Unmarshal(d.specSource, &root) != nil {
+		return err
+	}
+
+	var paths [][]string
+	if m := jsonFieldRegex.FindStringSubmatch(msg); m != nil {
+		paths = append(paths, strings.Split(m[1], "."))
+	}
+	if m := jsonUnknownFieldRegex.FindStringSubmatch(msg); m != nil {
+		paths = append(paths, []string{"**", m[1]})
+	}
+	for _, p := range specPathRegex.FindAllString(msg, -1) {
+		paths = append(paths, splitSpecPath(p))
+	}
+	for _, path := range paths {
+		if node := findSpecNode(&root, path); node != nil {
+			return &specError{File: d.specFile, Line: node.Line, Column: node.Column, err: err}
+		}
+	}
+	return err
+}
+
+// splitSpecPath splits paths like "services[0].name" into their segments, like
+// "services", "0" and "name".
+func splitSpecPath(path string) []string {
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	return strings.Split(path, ".")
+}
+
+// findSpecNode finds the node at the given path. Numeric segments index into
+// sequences. If a sequence is hit with a non-numeric segment, the first element
+// that contains the rest of the path is used. A "**" segment matches any depth.
+// For mappings, the key node is returned so the position points at the field.
+func findSpecNode(node *yamlv3.Node, path []string) *yamlv3.Node {
+	if len(path) == 0 {
+		return node
+	}
+
+	switch node.Kind {
+	case yamlv3.DocumentNode:
+		if len(node.Content) > 0 {
+			return findSpecNode(node.Content[0], path)
+		}
+	case yamlv3.MappingNode:
+		if path[0] == "**" {
+			if found := findSpecNode(node, path[1:]); found != nil {
+				return found
+			}
+			for i := 1; i < len(node.Content); i += 2 {
+				if found := findSpecNode(node.Content[i], path); found != nil {
+					return found
+				}
+			}
+			return nil
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value != path[0] {
+				continue
+			}
+			if len(path) == 1 {
+				return node.Content[i]
+			}
+			return findSpecNode(node.Content[i+1], path[1:])
+		}
+	case yamlv3.SequenceNode:
+		if idx, err := strconv.Atoi(path[0]); err == nil {
+			if idx >= 0 && idx < len(node.Content) {
+				return findSpecNode(node.Content[idx], path[1:])
+			}
+			return nil
+		}
+		for _, item := range node.Content {
+			if found := findSpecNode(item, path); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// specErrorAction returns an action that annotates messages with the position of
+// the given error in the app spec, if it's known.
+func specErrorAction(a *gha.Action, err error) *gha.Action {
+	var problemsErr *specProblemsError
+	if errors.As(err, &problemsErr) {
+		// Multiple problems are annotated individually, see annotateSpecProblems.
+		return a
+	}
+	var specErr *specError
+	if !errors.As(err, &specErr) {
+		return a
+	}
+
+	file := specErr.File
+	if ws := a.Getenv("GITHUB_WORKSPACE"); ws != "" && filepath.IsAbs(file) {
+		// Annotations are relative to the workspace.
+		if rel, err := filepath.Rel(ws, file); err == nil && !strings.HasPrefix(rel, "..") {
+			file = rel
+		}
+	}
+
+	fields := map[string]string{
+		"file": file,
+		"line": strconv.Itoa(specErr.Line),
+	}
+	if specErr.Column > 0 {
+		fields["col"] = strconv.Itoa(specErr.Column)
+	}
+	return a.WithFieldsMap(fields)
+}
+
+// annotateSpecProblems emits an error annotation for each individual problem if
+// the given error is caused by multiple problems in the app spec.
+func annotateSpecProblems(a *gha.Action, err error) {
+	var problemsErr *specProblemsError
+	if !errors.As(err, &problemsErr) {
+		return
+	}
+	for _, p := range problemsErr.problems {
+		specErrorAction(a, p).Errorf("%v", p)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/digitalocean/godo"
+	gha "github.com/sethvargo/go-githubactions"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocateSpecError(t *testing.T) {
+	source := []byte(`name: foo
+services:
+- name: web
+  instance_count: 1
+- name: api
+  instance_count: 2
+  routes:
+  - path: /api
+`)
+
+	tests := []struct {
+		name     string
+		err      error
+		expected *specError
+	}{{
+		name:     "yaml syntax error",
+		err:      errors.New("error converting YAML to JSON: yaml: line 4: mapping values are not allowed in this context"),
+		expected: &specError{File: "app.yaml", Line: 4},
+	}, {
+		name:     "json type error",
+		err:      errors.New("error unmarshaling JSON: while decoding JSON: json: cannot unmarshal string into Go struct field AppServiceSpec.services.instance_count of type int64"),
+		expected: &specError{File: "app.yaml", Line: 4, Column: 3},
+	}, {
+		name:     "unknown field",
+		err:      errors.New(`error unmarshaling JSON: while decoding JSON: json: unknown field "routes"`),
+		expected: &specError{File: "app.yaml", Line: 7, Column: 3},
+	}, {
+		name:     "api error with indices",
+		err:      apiError(`error validating app spec field "services[1].routes[0].path": invalid path`),
+		expected: &specError{File: "app.yaml", Line: 8, Column: 5},
+	}, {
+		name:     "api error with dotted indices",
+		err:      apiError(`services.1.name: name is already taken`),
+		expected: &specError{File: "app.yaml", Line: 5, Column: 3},
+	}, {
+		name: "unrelated error",
+		err:  errors.New("an error"),
+	}, {
+		name: "path not in spec",
+		err:  apiError(`services.3.name: invalid name`),
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := &deployer{
+				specFile:   "app.yaml",
+				specSource: source,
+			}
+			got := d.locateSpecError(test.err)
+			require.ErrorIs(t, got, test.err)
+
+			var specErr *specError
+			if test.expected == nil {
+				require.False(t, errors.As(got, &specErr))
+				return
+			}
+			require.ErrorAs(t, got, &specErr)
+			require.Equal(t, test.expected.File, specErr.File)
+			require.Equal(t, test.expected.Line, specErr.Line)
+			require.Equal(t, test.expected.Column, specErr.Column)
+		})
+	}
+}
+
+// apiError returns an API error with the given message.
+func apiError(msg string) error {
+	req, _ := http.NewRequest(http.MethodPost, "https://api.digitalocean.com/v2/apps", nil)
+	return &godo.ErrorResponse{
+		Response: &http.Response{Request: req, StatusCode: http.StatusBadRequest},
+		Message:  msg,
+	}
+}
+
+func TestCreateSpecAnnotatesParseErrors(t *testing.T) {
+	workspace := t.TempDir()
+	specFilePath := filepath.Join(workspace, ".do", "app.yaml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(specFilePath), 0755))
+	require.NoError(t, os.WriteFile(specFilePath, []byte("name: foo\nservices:\n- name: web\n  instance_count: many\n"), 0644))
+
+	d := &deployer{inputs: inputs{appSpecLocation: specFilePath}}
+	_, err := d.createSpec(context.Background())
+	require.Error(t, err)
+
+	var actionLogs bytes.Buffer
+	a := gha.New(gha.WithWriter(&actionLogs), gha.WithGetenv(func(k string) string {
+		if k == "GITHUB_WORKSPACE" {
+			return workspace
+		}
+		return ""
+	}))
+	specErrorAction(a, err).Errorf("failed to create spec")
+	require.Equal(t, "::error col=3,file=.do/app.yaml,line=4::failed to create spec\n", actionLogs.String())
+}
+
+func TestCreateSpecDoesNotAnnotateTemplates(t *testing.T) {
+	specFilePath := filepath.Join(t.TempDir(), "app.yaml")
+	// The error is on line 4 of the rendered spec, but on line 5 of the template.
+	require.NoError(t, os.WriteFile(specFilePath, []byte("name: foo\nservices:\n{{- if true }}\n- name: web\n  instance_count: many\n{{- end }}\n"), 0644))
+
+	d := &deployer{inputs: inputs{appSpecLocation: specFilePath, templateSpec: true}}
+	_, err := d.createSpec(context.Background())
+	require.ErrorContains(t, err, "failed to parse app spec")
+	var specErr *specError
+	require.False(t, errors.As(err, &specErr))
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+// summaryLogLines is the amount of log lines of a failing component shown in the summary.
+const summaryLogLines = 50
+
+// summary renders a markdown summary of the result for the job summary.
+func (r *deployResult) summary() string {
+	app := r.App
+	dep := r.Deployment
+
+	var b strings.Builder
+	switch {
+	case r.Skipped:
+		fmt.Fprintf(&b, "### :fast_forward: Skipped unchanged app `%s`\n\n", app.GetSpec().GetName())
+	case dep.GetPhase() == godo.DeploymentPhase_Active:
+		fmt.Fprintf(&b, "### :white_check_mark: Deployed app `%s`\n\n", app.GetSpec().GetName())
+	default:
+		fmt.Fprintf(&b, "### :x: Failed to deploy app `%s`\n\n", app.GetSpec().GetName())
+	}
+
+	action := "Updated"
+	if r.Created {
+		action = "Created"
+	} else if r.Skipped {
+		action = "Skipped"
+	}
+	b.WriteString("| | |\n| --- | --- |\n")
+	fmt.Fprintf(&b, "| Action | %s |\n", action)
+	if liveURL := app.GetLiveURL(); liveURL != "" {
+		fmt.Fprintf(&b, "| Live URL | %s |\n", liveURL)
+	}
+	fmt.Fprintf(&b, "| Deployment | [`%s`](https://cloud.digitalocean.com/apps/%s/deployments/%s) |\n", dep.GetID(), app.GetID(), dep.GetID())
+	fmt.Fprintf(&b, "| Phase | %s |\n", dep.GetPhase())
+	if cause := dep.GetCause(); cause != "" {
+		fmt.Fprintf(&b, "| Cause | %s |\n", cause)
+	}
+
+	if steps := dep.GetProgress().GetSummarySteps(); len(steps) > 0 {
+		b.WriteString("\n#### Phases\n\n")
+		b.WriteString("| Phase | Status | Duration |\n| --- | --- | --- |\n")
+		for _, step := range steps {
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", step.GetName(), step.GetStatus(), stepDuration(step))
+		}
+	}
+
+	commits := deployedCommits(dep)
+	var components strings.Builder
+	_ = app.GetSpec().ForEachAppComponentSpec(func(c godo.AppComponentSpec) error {
+		fmt.Fprintf(&components, "| %s | %s | %s |\n", c.GetName(), c.GetType(), componentSource(c, commits[c.GetName()]))
+		return nil
+	})
+	if components.Len() > 0 {
+		b.WriteString("\n#### Components\n\n")
+		b.WriteString("| Component | Type | Source |\n| --- | --- | --- |\n")
+		b.WriteString(components.String())
+	}
+
+	if dep.GetPhase() != godo.DeploymentPhase_Active {
+		component, stepName := failedComponent(dep.GetProgress().GetSteps())
+		logs := r.DeployLogs
+		if len(logs) == 0 || strings.Contains(stepName, "build") {
+			logs = r.BuildLogs
+		}
+		if tail := logTail(logs, component, summaryLogLines); tail != "" {
+			title := "Logs"
+			if component != "" {
+				title = fmt.Sprintf("Logs of failing component `%s`", component)
+			}
+			fmt.Fprintf(&b, "\n<details>\n<summary>%s</summary>\n\n```\n%s\n```\n</details>\n", title, tail)
+		}
+	}
+	return b.String()
+}
+
+// failureSummary renders a markdown summary of a deployment of the given app that
+// failed before a deployment existed, like on an invalid app spec.
+func failureSummary(app string, err error) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### :x: Failed to deploy app `%s`\n\n", app)
+	fmt.Fprintf(&b, "```\n%s\n```\n", strings.TrimSuffix(err.Error(), "\n"))
+	return b.String()
+}
+
+// stepDuration returns the formatted duration of the given step, or an empty
+// string if the step didn't finish.
+func stepDuration(step *godo.DeploymentProgressStep) string {
+	if step.GetStartedAt().IsZero() || step.GetEndedAt().IsZero() {
+		return ""
+	}
+	return step.GetEndedAt().Sub(step.GetStartedAt()).Round(time.Second).String()
+}
+
+// deployedCommits returns the commits deployed per component, keyed by component name.
+func deployedCommits(dep *godo.Deployment) map[string]string {
+	commits := make(map[string]string)
+	for _, c := range dep.GetServices() {
+		commits[c.GetName()] = c.GetSourceCommitHash()
+	}
+	for _, c := range dep.GetStaticSites() {
+		commits[c.GetName()] = c.GetSourceCommitHash()
+	}
+	for _, c := range dep.GetWorkers() {
+		commits[c.GetName()] = c.GetSourceCommitHash()
+	}
+	for _, c := range dep.GetJobs() {
+		commits[c.GetName()] = c.GetSourceCommitHash()
+	}
+	for _, c := range dep.GetFunctions() {
+		commits[c.GetName()] = c.GetSourceCommitHash()
+	}
+	return commits
+}
+
+// componentSource renders the source of the given component, including the
+// deployed commit if known.
+func componentSource(c godo.AppComponentSpec, commit string) string {
+	if cc, ok := c.(godo.AppContainerComponentSpec); ok && cc.GetImage() != nil {
+		return "`" + imageReference(cc.GetImage()) + "`"
+	}
+
+	bc, ok := c.(godo.AppBuildableComponentSpec)
+	if !ok {
+		return ""
+	}
+	var repo, branch string
+	switch {
+	case bc.GetGitHub() != nil:
+		repo, branch = bc.GetGitHub().GetRepo(), bc.GetGitHub().GetBranch()
+	case bc.GetGitLab() != nil:
+		repo, branch = bc.GetGitLab().GetRepo(), bc.GetGitLab().GetBranch()
+	case bc.GetBitbucket() != nil:
+		repo, branch = bc.GetBitbucket().GetRepo(), bc.GetBitbucket().GetBranch()
+	case bc.GetGit() != nil:
+		repo, branch = bc.GetGit().GetRepoCloneURL(), bc.GetGit().GetBranch()
+	default:
+		return ""
+	}
+	if len(commit) > 7 {
+		commit = commit[:7]
+	}
+	if commit != "" {
+		return fmt.Sprintf("`%s@%s` (%s)", repo, commit, branch)
+	}
+	return fmt.Sprintf("`%s` (%s)", repo, branch)
+}
+
+// imageReference renders the given image in the usual `registry/repository:tag` notation.
+func imageReference(image *godo.ImageSourceSpec) string {
+	var ref string
+	switch image.GetRegistryType() {
+	case godo.ImageSourceSpecRegistryType_DOCR:
+		ref = "registry.digitalocean.com/"
+	case godo.ImageSourceSpecRegistryType_Ghcr:
+		ref = "ghcr.io/"
+	}
+	if image.GetRegistry() != "" {
+		ref += image.GetRegistry() + "/"
+	}
+	ref += image.GetRepository()
+	if image.GetDigest() != "" {
+		return ref + "@" + image.GetDigest()
+	}
+	if image.GetTag() != "" {
+		return ref + ":" + image.GetTag()
+	}
+	return ref
+}
+
+// failedComponent finds the first component with a failed step in the given steps
+// and returns its name alongside the name of the top-level step it failed in.
+func failedComponent(steps []*godo.DeploymentProgressStep) (string, string) {
+	for _, step := range steps {
+		if step.GetStatus() != godo.DeploymentProgressStepStatus_Error {
+			continue
+		}
+		if step.GetComponentName() != "" {
+			return step.GetComponentName(), step.GetName()
+		}
+		if component, _ := failedComponent(step.GetSteps()); component != "" {
+			return component, step.GetName()
+		}
+	}
+	return "", ""
+}
+
+// logTail returns the last n lines of the given logs. If a component is given,
+// only its lines are considered if the logs contain any.
+func logTail(logs []byte, component string, n int) string {
+	lines := strings.Split(string(bytes.TrimRight(logs, "\n")), "\n")
+	if component != "" {
+		var componentLines []string
+		for _, line := range lines {
+			if strings.HasPrefix(line, component+" ") {
+				componentLines = append(componentLines, line)
+			}
+		}
+		if len(componentLines) > 0 {
+			lines = componentLines
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
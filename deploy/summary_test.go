@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeployResultSummary(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	res := &deployResult{
+		App: &godo.App{
+			ID: "app-id",
+			Spec: &godo.AppSpec{
+				Name: "foo",
+				Services: []*godo.AppServiceSpec{{
+					Name: "web",
+					GitHub: &godo.GitHubSourceSpec{
+						Repo:   "foo/bar",
+						Branch: "main",
+					},
+				}},
+				Workers: []*godo.AppWorkerSpec{{
+					Name: "worker",
+					Image: &godo.ImageSourceSpec{
+						RegistryType: godo.ImageSourceSpecRegistryType_Ghcr,
+						Registry:     "foo",
+						Repository:   "worker",
+						Tag:          "v1",
+					},
+				}},
+			},
+		},
+		Deployment: &godo.Deployment{
+			ID:       "deployment-id",
+			Phase:    godo.DeploymentPhase_Error,
+			Services: []*godo.DeploymentService{{Name: "web", SourceCommitHash: "1234567890abcdef"}},
+			Progress: &godo.DeploymentProgress{
+				SummarySteps: []*godo.DeploymentProgressStep{{
+					Name:      "build",
+					Status:    godo.DeploymentProgressStepStatus_Error,
+					StartedAt: start,
+					EndedAt:   start.Add(90 * time.Second),
+				}},
+				Steps: []*godo.DeploymentProgressStep{{
+					Name:   "build",
+					Status: godo.DeploymentProgressStepStatus_Error,
+					Steps: []*godo.DeploymentProgressStep{{
+						Name:          "build-web",
+						Status:        godo.DeploymentProgressStepStatus_Error,
+						ComponentName: "web",
+					}},
+				}},
+			},
+		},
+		Created:   true,
+		BuildLogs: []byte("worker building\nweb building\nweb failed\n"),
+	}
+
+	require.Equal(t, "### :x: Failed to deploy app `foo`\n\n"+
+		"| | |\n| --- | --- |\n"+
+		"| Action | Created |\n"+
+		"| Deployment | [`deployment-id`](https://cloud.digitalocean.com/apps/app-id/deployments/deployment-id) |\n"+
+		"| Phase | ERROR |\n"+
+		"\n#### Phases\n\n"+
+		"| Phase | Status | Duration |\n| --- | --- | --- |\n"+
+		"| build | ERROR | 1m30s |\n"+
+		"\n#### Components\n\n"+
+		"| Component | Type | Source |\n| --- | --- | --- |\n"+
+		"| web | service | `foo/bar@1234567` (main) |\n"+
+		"| worker | worker | `ghcr.io/foo/worker:v1` |\n"+
+		"\n<details>\n<summary>Logs of failing component `web`</summary>\n\n```\nweb building\nweb failed\n```\n</details>\n",
+		res.summary())
+}
+
+func TestFailureSummary(t *testing.T) {
+	require.Equal(t, "### :x: Failed to deploy app `foo`\n\n```\nfailed to update app: invalid spec\n```\n",
+		failureSummary("foo", errors.New("failed to update app: invalid spec")))
+}
+
+func TestImageReference(t *testing.T) {
+	tests := []struct {
+		name     string
+		image    *godo.ImageSourceSpec
+		expected string
+	}{{
+		name: "docr",
+		image: &godo.ImageSourceSpec{
+			RegistryType: godo.ImageSourceSpecRegistryType_DOCR,
+			Repository:   "bar",
+			Tag:          "v1",
+		},
+		expected: "registry.digitalocean.com/bar:v1",
+	}, {
+		name: "ghcr with digest",
+		image: &godo.ImageSourceSpec{
+			RegistryType: godo.ImageSourceSpecRegistryType_Ghcr,
+			Registry:     "foo",
+			Repository:   "bar",
+			Digest:       "sha256:1234",
+		},
+		expected: "ghcr.io/foo/bar@sha256:1234",
+	}, {
+		name: "docker hub without tag",
+		image: &godo.ImageSourceSpec{
+			RegistryType: godo.ImageSourceSpecRegistryType_DockerHub,
+			Registry:     "foo",
+			Repository:   "bar",
+		},
+		expected: "foo/bar",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, imageReference(test.image))
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"text/template"
+	"text/template/parse"
+
+	"sigs.k8s.io/yaml"
+)
+
+// templateData is the data available to app spec templates.
+type templateData struct {
+	// Values are the values read from the values file.
+	Values map[string]any
+}
+
+// optionalValueFunc is the template function that looks up values which may be
+// missing, see markOptionalValues.
+const optionalValueFunc = "optionalValue"
+
+// renderSpecTemplate renders the given app spec as a Go template with the values
+// from the configured values file. Bindable variable references like
+// ${component.VAR} are not touched by the template engine, so they survive
+// rendering unchanged.
+//
+// Referencing a missing value fails rendering, unless the value is passed to
+// default or required or is the sole condition of an if or with.
+func (d *deployer) renderSpecTemplate(location string, spec []byte) ([]byte, error) {
+	data := templateData{Values: map[string]any{}}
+	if d.inputs.valuesFile != "" {
+		bs, err := os.ReadFile(d.inputs.valuesFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read values file: %w", err)
+		}
+		if err := yaml.Unmarshal(bs, &data.Values); err != nil {
+			return nil, fmt.Errorf("failed to parse values file: %w", err)
+		}
+	}
+
+	tmpl, err := template.New(location).Option("missingkey=error").Funcs(template.FuncMap{
+		"default":         templateDefault,
+		"required":        templateRequired,
+		"toJSON":          templateToJSON,
+		"env":             d.getenv,
+		optionalValueFunc: templateOptionalValue,
+	}).Parse(string(spec))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse app spec template: %w", err)
+	}
+	markOptionalValues(tmpl.Tree.Root)
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render app spec template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// templateDefault returns def if val is empty (see isEmptyTemplateValue) and val
+// otherwise. It's meant to be used in pipelines, like
+// {{ .Values.instances | default 1 }}.
+func templateDefault(def, val any) any {
+	if isEmptyTemplateValue(val) {
+		return def
+	}
+	return val
+}
+
+// templateRequired fails rendering with the given message if val is empty and
+// returns val otherwise.
+func templateRequired(msg string, val any) (any, error) {
+	if isEmptyTemplateValue(val) {
+		return nil, errors.New(msg)
+	}
+	return val, nil
+}
+
+// templateToJSON renders the given value as JSON, which is valid inline YAML.
+func templateToJSON(val any) (string, error) {
+	bs, err := json.Marshal(val)
+	if err != nil {
+		return "", err
+	}
+	return string(bs), nil
+}
+
+// isEmptyTemplateValue returns whether the given value is nil or its type's zero
+// value, or an empty collection.
+func isEmptyTemplateValue(val any) bool {
+	if val == nil {
+		return true
+	}
+	v := reflect.ValueOf(val)
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.String:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// markOptionalValues rewrites references to values that may be missing into
+// lookups via templateOptionalValue, which yield nil for missing values rather
+// than failing like missingkey=error does otherwise. Values may be missing if
+// they're passed to default or required, like `.Values.region | default "nyc"`,
+// or if they're the sole condition of an if or with.
+func markOptionalValues(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			markOptionalValues(child)
+		}
+	case *parse.ActionNode:
+		markOptionalPipe(n.Pipe)
+	case *parse.TemplateNode:
+		markOptionalPipe(n.Pipe)
+	case *parse.IfNode:
+		markOptionalBranch(&n.BranchNode)
+	case *parse.WithNode:
+		markOptionalBranch(&n.BranchNode)
+	case *parse.RangeNode:
+		markOptionalPipe(n.Pipe)
+		markOptionalValues(n.List)
+		markOptionalValues(n.ElseList)
+	}
+}
+
+// markOptionalBranch marks the optional values of an if or with.
+func markOptionalBranch(n *parse.BranchNode) {
+	if n.Pipe != nil && len(n.Pipe.Cmds) == 1 && len(n.Pipe.Cmds[0].Args) == 1 {
+		n.Pipe.Cmds[0].Args[0] = optionalArg(n.Pipe.Cmds[0].Args[0])
+	}
+	markOptionalPipe(n.Pipe)
+	markOptionalValues(n.List)
+	markOptionalValues(n.ElseList)
+}
+
+// markOptionalPipe marks the optional values of the given pipeline.
+func markOptionalPipe(pipe *parse.PipeNode) {
+	if pipe == nil {
+		return
+	}
+	for i, cmd := range pipe.Cmds {
+		if ident, ok := cmd.Args[0].(*parse.IdentifierNode); ok && (ident.Ident == "default" || ident.Ident == "required") {
+			for j := 1; j < len(cmd.Args); j++ {
+				cmd.Args[j] = optionalArg(cmd.Args[j])
+			}
+			// The value piped into default or required, like in
+			// `.Values.region | default "nyc"`.
+			if i == 1 && len(pipe.Cmds[0].Args) == 1 {
+				pipe.Cmds[0].Args[0] = optionalArg(pipe.Cmds[0].Args[0])
+			}
+		}
+		for _, arg := range cmd.Args {
+			if p, ok := arg.(*parse.PipeNode); ok {
+				markOptionalPipe(p)
+			}
+		}
+	}
+}
+
+// optionalArg returns a node looking up the value the given field or variable
+// node references via templateOptionalValue. Other nodes are returned as is.
+func optionalArg(arg parse.Node) parse.Node {
+	var base parse.Node
+	var path []string
+	switch n := arg.(type) {
+	case *parse.FieldNode:
+		base, path = &parse.DotNode{NodeType: parse.NodeDot, Pos: n.Pos}, n.Ident
+	case *parse.VariableNode:
+		if len(n.Ident) < 2 {
+			return arg
+		}
+		base = &parse.VariableNode{NodeType: parse.NodeVariable, Pos: n.Pos, Ident: n.Ident[:1]}
+		path = n.Ident[1:]
+	default:
+		return arg
+	}
+
+	args := []parse.Node{parse.NewIdentifier(optionalValueFunc).SetPos(arg.Position()), base}
+	for _, key := range path {
+		args = append(args, &parse.StringNode{NodeType: parse.NodeString, Pos: arg.Position(), Quoted: strconv.Quote(key), Text: key})
+	}
+	return &parse.PipeNode{NodeType: parse.NodePipe, Pos: arg.Position(), Cmds: []*parse.CommandNode{{
+		NodeType: parse.NodeCommand,
+		Pos:      arg.Position(),
+		Args:     args,
+	}}}
+}
+
+// templateOptionalValue returns the value at the given path of fields and map
+// keys below base, or nil if any of them is missing.
+func templateOptionalValue(base any, path ...string) any {
+	v := reflect.ValueOf(base)
+	for _, key := range path {
+		for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return nil
+			}
+			v = v.Elem()
+		}
+		switch v.Kind() {
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return nil
+			}
+			v = v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key()))
+		case reflect.Struct:
+			v = v.FieldByName(key)
+		default:
+			return nil
+		}
+		if !v.IsValid() {
+			return nil
+		}
+	}
+	if !v.IsValid() || !v.CanInterface() {
+		return nil
+	}
+	return v.Interface()
+}
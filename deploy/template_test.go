@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/digitalocean/godo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateSpecFromTemplate(t *testing.T) {
+	dir := t.TempDir()
+	specFilePath := filepath.Join(dir, "app.yaml")
+	valuesFilePath := filepath.Join(dir, "values.yaml")
+	require.NoError(t, os.WriteFile(specFilePath, []byte(`name: {{ required "name is required" .Values.name }}
+region: {{ .Values.region | default "nyc" }}
+alerts: {{ toJSON .Values.alerts }}
+services:
+- name: web
+  instance_count: {{ .Values.instances | default 1 }}
+  envs:
+  - key: STAGE
+    value: {{ env "STAGE" }}
+  - key: DB_URL
+    value: ${db.DATABASE_URL}
+{{- if .Values.worker }}
+workers:
+- name: worker
+{{- end }}
+`), 0644))
+	require.NoError(t, os.WriteFile(valuesFilePath, []byte(`name: foo
+instances: 3
+worker: true
+alerts:
+- rule: DEPLOYMENT_FAILED
+`), 0644))
+	t.Setenv("STAGE", "production")
+
+	d := &deployer{inputs: inputs{appSpecLocation: specFilePath, templateSpec: true, valuesFile: valuesFilePath}}
+	got, err := d.createSpec(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, &godo.AppSpec{
+		Name:   "foo",
+		Region: "nyc", // Default applied.
+		Alerts: []*godo.AppAlertSpec{{Rule: godo.AppAlertSpecRule_DeploymentFailed}},
+		Services: []*godo.AppServiceSpec{{
+			Name:          "web",
+			InstanceCount: 3,
+			Envs: []*godo.AppVariableDefinition{{
+				Key:   "STAGE",
+				Value: "production",
+			}, {
+				Key:   "DB_URL",
+				Value: "${db.DATABASE_URL}", // Bindable reference stayed intact.
+			}},
+		}},
+		Workers: []*godo.AppWorkerSpec{{Name: "worker"}},
+	}, got)
+
+	require.NoError(t, os.WriteFile(valuesFilePath, []byte(`region: ams`), 0644))
+	_, err = d.createSpec(context.Background())
+	require.ErrorContains(t, err, "name is required")
+}
+
+func TestCreateSpecFromTemplateMissingValue(t *testing.T) {
+	dir := t.TempDir()
+	specFilePath := filepath.Join(dir, "app.yaml")
+	valuesFilePath := filepath.Join(dir, "values.yaml")
+	require.NoError(t, os.WriteFile(valuesFilePath, []byte(`name: foo
+region: ams
+`), 0644))
+	d := &deployer{inputs: inputs{appSpecLocation: specFilePath, templateSpec: true, valuesFile: valuesFilePath}}
+
+	// A typo fails rendering rather than deploying "<no value>".
+	require.NoError(t, os.WriteFile(specFilePath, []byte(`name: {{ .Values.name }}
+region: {{ .Values.regoin }}
+`), 0644))
+	_, err := d.createSpec(context.Background())
+	require.ErrorContains(t, err, `map has no entry for key "regoin"`)
+
+	// Missing values are fine where they're optional.
+	require.NoError(t, os.WriteFile(specFilePath, []byte(`name: {{ .Values.name }}
+region: {{ default "nyc" .Values.regoin }}
+{{- with .Values.worker }}
+workers:
+- name: {{ .name | default "worker" }}
+{{- end }}
+{{- if .Values.features }}
+features: {{ toJSON .Values.features }}
+{{- end }}
+`), 0644))
+	got, err := d.createSpec(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, &godo.AppSpec{Name: "foo", Region: "nyc"}, got)
+}
+
+func TestTemplateDefault(t *testing.T) {
+	require.Equal(t, 1, templateDefault(1, nil))
+	require.Equal(t, "a", templateDefault("a", ""))
+	require.Equal(t, "a", templateDefault("a", []any{}))
+	require.Equal(t, 1, templateDefault(1, 0))
+	require.Equal(t, true, templateDefault(true, false)) // Like zero numbers, false is empty.
+	require.Equal(t, "b", templateDefault("a", "b"))
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/digitalocean/godo"
+)
+
+// serverDefaultFields are the fields of an app spec the platform populates with
+// defaults if they're not set.
+var serverDefaultFields = map[string]bool{
+	"region":             true,
+	"instance_count":     true,
+	"instance_size_slug": true,
+	"http_port":          true,
+	"scope":              true,
+	"ingress":            true,
+	"routes":             true,
+}
+
+// appUnchanged returns whether deploying the given spec wouldn't change the given
+// app. If it would, the reason is returned as well.
+//
+// Fields set in the app but not in the spec are ignored if they're one of
+// serverDefaultFields, since the platform populates those. SECRET values are
+// ignored, since the app only contains them encrypted. Components deployed from
+// the current repository must have the current commit deployed, components from
+// other repositories are always considered changed since their latest commit is
+// unknown.
+func (d *deployer) appUnchanged(spec *godo.AppSpec, app *godo.App) (bool, string, error) {
+	ours, err := normalizeSpec(spec)
+	if err != nil {
+		return false, "", err
+	}
+	live, err := normalizeSpec(app.GetSpec())
+	if err != nil {
+		return false, "", err
+	}
+	if !reflect.DeepEqual(ours, pruneAbsent(live, ours)) {
+		return false, "the app spec differs", nil
+	}
+
+	dep := app.GetActiveDeployment()
+	if dep == nil {
+		return false, "the app has no active deployment", nil
+	}
+	sha, repo := d.action.Getenv("GITHUB_SHA"), d.action.Getenv("GITHUB_REPOSITORY")
+	commits := deployedCommits(dep)
+	var reason string
+	_ = spec.ForEachAppComponentSpec(func(c godo.AppComponentSpec) error {
+		bc, ok := c.(godo.AppBuildableComponentSpec)
+		if !ok || reason != "" {
+			return nil
+		}
+		if bc.GetGitHub() == nil && bc.GetGitLab() == nil && bc.GetBitbucket() == nil && bc.GetGit() == nil {
+			return nil
+		}
+		if bc.GetGitHub().GetRepo() != repo || sha == "" {
+			reason = fmt.Sprintf("the latest commit of component %q is unknown", c.GetName())
+			return nil
+		}
+		if commit := commits[c.GetName()]; commit == "" || !strings.HasPrefix(sha, commit) {
+			reason = fmt.Sprintf("component %q doesn't have commit %s deployed", c.GetName(), sha)
+		}
+		return nil
+	})
+	return reason == "", reason, nil
+}
+
+// normalizeSpec returns the given spec as a generic JSON value, with the values
+// of SECRET variables removed.
+func normalizeSpec(spec *godo.AppSpec) (map[string]any, error) {
+	bs, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal app spec: %w", err)
+	}
+	var normalized *godo.AppSpec
+	if err := json.Unmarshal(bs, &normalized); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal app spec: %w", err)
+	}
+	if normalized != nil {
+		forEachEnv(normalized, func(_ string, env *godo.AppVariableDefinition) {
+			if env.GetType() == godo.AppVariableType_Secret {
+				env.Value = ""
+			}
+		})
+	}
+
+	if bs, err = json.Marshal(normalized); err != nil {
+		return nil, fmt.Errorf("failed to marshal app spec: %w", err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(bs, &m); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal app spec: %w", err)
+	}
+	return m, nil
+}
+
+// pruneAbsent removes the serverDefaultFields from the given value that the
+// reference value doesn't have. Lists are pruned item by item if they have the
+// same length.
+func pruneAbsent(value, reference any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		ref, ok := reference.(map[string]any)
+		if !ok {
+			return value
+		}
+		pruned := make(map[string]any, len(v))
+		for k, item := range v {
+			if refItem, ok := ref[k]; ok {
+				pruned[k] = pruneAbsent(item, refItem)
+			} else if !serverDefaultFields[k] {
+				pruned[k] = item
+			}
+		}
+		return pruned
+	case []any:
+		ref, ok := reference.([]any)
+		if !ok || len(ref) != len(v) {
+			return value
+		}
+		pruned := make([]any, len(v))
+		for i := range v {
+			pruned[i] = pruneAbsent(v[i], ref[i])
+		}
+		return pruned
+	}
+	return value
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	"github.com/digitalocean/godo"
+	gha "github.com/sethvargo/go-githubactions"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppUnchanged(t *testing.T) {
+	spec := func() *godo.AppSpec {
+		return &godo.AppSpec{
+			Name: "app",
+			Services: []*godo.AppServiceSpec{{
+				Name:   "web",
+				GitHub: &godo.GitHubSourceSpec{Repo: "org/repo", Branch: "main"},
+				Envs: []*godo.AppVariableDefinition{
+					{Key: "TOKEN", Value: "plain", Type: godo.AppVariableType_Secret},
+					{Key: "MODE", Value: "prod"},
+				},
+			}},
+		}
+	}
+	live := func() *godo.App {
+		s := spec()
+		// Defaults filled in by the platform.
+		s.Region = "nyc"
+		s.Services[0].InstanceCount = 1
+		s.Services[0].HTTPPort = 8080
+		s.Services[0].Envs[0].Value = "EV[1:abc:def]"
+		s.Services[0].Envs[1].Scope = godo.AppVariableScope_RunAndBuildTime
+		return &godo.App{
+			Spec: s,
+			ActiveDeployment: &godo.Deployment{
+				Services: []*godo.DeploymentService{{Name: "web", SourceCommitHash: "abc123"}},
+			},
+		}
+	}
+	env := map[string]string{"GITHUB_SHA": "abc123", "GITHUB_REPOSITORY": "org/repo"}
+	d := &deployer{action: gha.New(gha.WithWriter(io.Discard), gha.WithGetenv(func(k string) string { return env[k] }))}
+
+	tests := []struct {
+		name       string
+		spec       func(*godo.AppSpec)
+		app        func(*godo.App)
+		wantReason string
+	}{{
+		name: "unchanged",
+	}, {
+		name:       "changed variable",
+		spec:       func(s *godo.AppSpec) { s.Services[0].Envs[1].Value = "dev" },
+		wantReason: "the app spec differs",
+	}, {
+		name:       "removed variable",
+		spec:       func(s *godo.AppSpec) { s.Services[0].Envs = s.Services[0].Envs[:1] },
+		wantReason: "the app spec differs",
+	}, {
+		name:       "removed field",
+		app:        func(a *godo.App) { a.Spec.Services[0].BuildCommand = "make" },
+		wantReason: "the app spec differs",
+	}, {
+		name:       "added component",
+		spec:       func(s *godo.AppSpec) { s.Workers = []*godo.AppWorkerSpec{{Name: "worker"}} },
+		wantReason: "the app spec differs",
+	}, {
+		name:       "other commit deployed",
+		app:        func(a *godo.App) { a.ActiveDeployment.Services[0].SourceCommitHash = "def456" },
+		wantReason: `component "web" doesn't have commit abc123 deployed`,
+	}, {
+		name:       "no active deployment",
+		app:        func(a *godo.App) { a.ActiveDeployment = nil },
+		wantReason: "the app has no active deployment",
+	}, {
+		name: "other repository",
+		spec: func(s *godo.AppSpec) { s.Services[0].GitHub.Repo = "org/other" },
+		app: func(a *godo.App) {
+			a.Spec.Services[0].GitHub.Repo = "org/other"
+		},
+		wantReason: `the latest commit of component "web" is unknown`,
+	}, {
+		name: "image component",
+		spec: func(s *godo.AppSpec) {
+			s.Services[0].GitHub = nil
+			s.Services[0].Image = &godo.ImageSourceSpec{RegistryType: godo.ImageSourceSpecRegistryType_DOCR, Repository: "web", Tag: "v1"}
+		},
+		app: func(a *godo.App) {
+			a.Spec.Services[0].GitHub = nil
+			a.Spec.Services[0].Image = &godo.ImageSourceSpec{RegistryType: godo.ImageSourceSpecRegistryType_DOCR, Repository: "web", Tag: "v1"}
+			a.ActiveDeployment.Services = nil
+		},
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, app := spec(), live()
+			if test.spec != nil {
+				test.spec(s)
+			}
+			if test.app != nil {
+				test.app(app)
+			}
+			unchanged, reason, err := d.appUnchanged(s, app)
+			require.NoError(t, err)
+			require.Equal(t, test.wantReason == "", unchanged)
+			require.Equal(t, test.wantReason, reason)
+		})
+	}
+}
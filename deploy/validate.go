@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/digitalocean/godo"
+	yamlv3 "sigs.k8s.io/yaml/goyaml.v3"
+)
+
+var (
+	// nameRegex matches valid app and component names.
+	nameRegex = regexp.MustCompile(`^[a-z][a-z0-9-]{0,30}[a-z0-9]$`)
+	// bindableRegex matches bindable variable references to components, like
+	// "${web.PRIVATE_URL}".
+	bindableRegex = regexp.MustCompile(`\$\{([A-Za-z0-9_-]+)\.[A-Za-z0-9_.]+\}`)
+)
+
+// componentSpecKeys maps component types to the key they're defined under in the app spec.
+var componentSpecKeys = map[godo.AppComponentType]string{
+	godo.AppComponentTypeService:    "services",
+	godo.AppComponentTypeWorker:     "workers",
+	godo.AppComponentTypeJob:        "jobs",
+	godo.AppComponentTypeStaticSite: "static_sites",
+	godo.AppComponentTypeDatabase:   "databases",
+	godo.AppComponentTypeFunctions:  "functions",
+}
+
+// specProblem is a problem found in an app spec.
+type specProblem struct {
+	// path is the path to the offending field in the app spec.
+	path []string
+	// msg describes the problem.
+	msg string
+}
+
+// specProblemsError is returned if an app spec has one or more problems.
+type specProblemsError struct {
+	problems []error
+}
+
+// Error implements error.
+func (e *specProblemsError) Error() string {
+	msgs := make([]string, 0, len(e.problems))
+	for _, p := range e.problems {
+		msgs = append(msgs, "- "+p.Error())
+	}
+	return fmt.Sprintf("app spec has %d problem(s):\n%s", len(e.problems), strings.Join(msgs, "\n"))
+}
+
+// Unwrap returns the individual problems.
+func (e *specProblemsError) Unwrap() []error {
+	return e.problems
+}
+
+// validateSpecStrictly checks the given app spec and its source for problems that
+// would otherwise only be found by the API or not at all. All problems are
+// reported together, each attributed to its position in the app spec if possible.
+func (d *deployer) validateSpecStrictly(spec *godo.AppSpec) error {
+	var root yamlv3.Node
+	if err := yamlv3.Unmarshal(d.specSource, &root); err != nil {
+		return fmt.Errorf("failed to parse app spec: %w", err)
+	}
+
+	var problems []specProblem
+	if len(root.Content) > 0 {
+		problems = append(problems, unknownSpecFields(root.Content[0], reflect.TypeOf(godo.AppSpec{}), nil)...)
+	}
+	problems = append(problems, validateSpec(spec)...)
+	if len(problems) == 0 {
+		return nil
+	}
+
+	errs := make([]error, 0, len(problems))
+	for _, p := range problems {
+		var err error = fmt.Errorf("%s: %s", strings.Join(p.path, "."), p.msg)
+		if node := findSpecNode(&root, p.path); node != nil && d.specFile != "" {
+			err = &specError{File: d.specFile, Line: node.Line, Column: node.Column, err: err}
+		}
+		errs = append(errs, err)
+	}
+	return &specProblemsError{problems: errs}
+}
+
+// unknownSpecFields returns a problem for every field in the given node that
+// has no counterpart in the given type.
+func unknownSpecFields(node *yamlv3.Node, t reflect.Type, path []string) []specProblem {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var problems []specProblem
+	switch {
+	case node.Kind == yamlv3.MappingNode && t.Kind() == reflect.Struct:
+		fields := jsonFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			fieldPath := append(append([]string{}, path...), key)
+			ft, ok := fields[key]
+			if !ok && key == buildContextKey && isComponentPath(path) {
+				// Annotation for build mode, see buildImages.
+				continue
+			}
+			if !ok {
+				problems = append(problems, specProblem{path: fieldPath, msg: fmt.Sprintf("unknown field %q", key)})
+				continue
+			}
+			problems = append(problems, unknownSpecFields(node.Content[i+1], ft, fieldPath)...)
+		}
+	case node.Kind == yamlv3.MappingNode && t.Kind() == reflect.Map:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			fieldPath := append(append([]string{}, path...), node.Content[i].Value)
+			problems = append(problems, unknownSpecFields(node.Content[i+1], t.Elem(), fieldPath)...)
+		}
+	case node.Kind == yamlv3.SequenceNode && t.Kind() == reflect.Slice:
+		for i, item := range node.Content {
+			itemPath := append(append([]string{}, path...), strconv.Itoa(i))
+			problems = append(problems, unknownSpecFields(item, t.Elem(), itemPath)...)
+		}
+	}
+	return problems
+}
+
+// isComponentPath returns whether the given path points at a component, like
+// "services.0".
+func isComponentPath(path []string) bool {
+	if len(path) != 2 {
+		return false
+	}
+	for _, key := range componentSpecKeys {
+		if path[0] == key {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonFields returns the types of the fields of the given struct type, keyed by
+// their JSON name.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// validateSpec checks the given app spec for semantic problems.
+func validateSpec(spec *godo.AppSpec) []specProblem {
+	var problems []specProblem
+	if !nameRegex.MatchString(spec.GetName()) {
+		problems = append(problems, specProblem{path: []string{"name"}, msg: invalidNameMsg(spec.GetName())})
+	}
+
+	// Collect all components first, so references can be checked against them.
+	type component struct {
+		spec godo.AppComponentSpec
+		path []string
+	}
+	var components []component
+	indices := make(map[string]int)
+	_ = spec.ForEachAppComponentSpec(func(c godo.AppComponentSpec) error {
+		key := componentSpecKeys[c.GetType()]
+		components = append(components, component{spec: c, path: []string{key, strconv.Itoa(indices[key])}})
+		indices[key]++
+		return nil
+	})
+
+	names := make(map[string]struct{}, len(components))
+	for _, c := range components {
+		name := c.spec.GetName()
+		namePath := append(append([]string{}, c.path...), "name")
+		if !nameRegex.MatchString(name) {
+			problems = append(problems, specProblem{path: namePath, msg: invalidNameMsg(name)})
+		}
+		if _, ok := names[name]; ok {
+			problems = append(problems, specProblem{path: namePath, msg: fmt.Sprintf("component name %q is used more than once", name)})
+		}
+		names[name] = struct{}{}
+	}
+
+	// Images must not define both a tag and a digest.
+	for _, c := range components {
+		cc, ok := c.spec.(godo.AppContainerComponentSpec)
+		if !ok || cc.GetImage() == nil {
+			continue
+		}
+		if cc.GetImage().GetTag() != "" && cc.GetImage().GetDigest() != "" {
+			problems = append(problems, specProblem{
+				path: append(append([]string{}, c.path...), "image", "digest"),
+				msg:  "image must not define both a tag and a digest",
+			})
+		}
+	}
+
+	// Routes must be unique across the app.
+	routes := make(map[string]struct{})
+	addRoute := func(route string, path []string) {
+		normalized := strings.TrimSuffix(route, "/")
+		if _, ok := routes[normalized]; ok {
+			problems = append(problems, specProblem{path: path, msg: fmt.Sprintf("route %q collides with another route", route)})
+		}
+		routes[normalized] = struct{}{}
+	}
+	for i, rule := range spec.GetIngress().GetRules() {
+		if prefix := rule.GetMatch().GetPath().GetPrefix(); prefix != "" {
+			addRoute(prefix, []string{"ingress", "rules", strconv.Itoa(i), "match", "path", "prefix"})
+		}
+		if name := rule.GetComponent().GetName(); name != "" {
+			if _, ok := names[name]; !ok {
+				problems = append(problems, specProblem{
+					path: []string{"ingress", "rules", strconv.Itoa(i), "component", "name"},
+					msg:  fmt.Sprintf("ingress rule routes to unknown component %q", name),
+				})
+			}
+		}
+	}
+	for _, c := range components {
+		rc, ok := c.spec.(godo.AppRoutableComponentSpec)
+		if !ok {
+			continue
+		}
+		for i, route := range rc.GetRoutes() {
+			if route.GetPath() != "" {
+				addRoute(route.GetPath(), append(append([]string{}, c.path...), "routes", strconv.Itoa(i), "path"))
+			}
+		}
+	}
+
+	// Bindable variables must reference existing components.
+	checkEnvs := func(envs []*godo.AppVariableDefinition, path []string) {
+		for i, env := range envs {
+			for _, m := range bindableRegex.FindAllStringSubmatch(env.GetValue(), -1) {
+				if _, ok := names[m[1]]; ok || m[1] == "_self" {
+					continue
+				}
+				problems = append(problems, specProblem{
+					path: append(append([]string{}, path...), strconv.Itoa(i), "value"),
+					msg:  fmt.Sprintf("%s references unknown component %q", m[0], m[1]),
+				})
+			}
+		}
+	}
+	checkEnvs(spec.GetEnvs(), []string{"envs"})
+	for _, c := range components {
+		if bc, ok := c.spec.(godo.AppBuildableComponentSpec); ok {
+			checkEnvs(bc.GetEnvs(), append(append([]string{}, c.path...), "envs"))
+		}
+	}
+	return problems
+}
+
+// invalidNameMsg describes why the given name is invalid.
+func invalidNameMsg(name string) string {
+	return fmt.Sprintf("name %q must be 2 to 32 characters long, consist of lowercase letters, digits and dashes, start with a letter and end with a letter or digit", name)
+}
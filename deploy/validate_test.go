@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gha "github.com/sethvargo/go-githubactions"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateSpecStrictly(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		expected []string
+	}{{
+		name: "valid",
+		spec: `name: foo
+envs:
+- key: API_URL
+  value: ${api.PUBLIC_URL}
+services:
+- name: api
+  instance_size_slug: apps-s-1vcpu-1gb
+  image:
+    registry_type: DOCR
+    repository: api
+    tag: v1
+  envs:
+  - key: SELF
+    value: ${_self.PRIVATE_URL}
+  - key: DB
+    value: ${db.DATABASE_URL}
+databases:
+- name: db
+  engine: PG
+ingress:
+  rules:
+  - match:
+      path:
+        prefix: /api
+    component:
+      name: api
+`,
+	}, {
+		name: "unknown fields",
+		spec: `name: foo
+services:
+- name: api
+  instance_size_slugg: apps-s-1vcpu-1gb
+  image:
+    registry_typ: DOCR
+`,
+		expected: []string{
+			`4:3: services.0.instance_size_slugg: unknown field "instance_size_slugg"`,
+			`6:5: services.0.image.registry_typ: unknown field "registry_typ"`,
+		},
+	}, {
+		name: "semantic problems",
+		spec: `name: Foo_App
+envs:
+- key: WORKER
+  value: ${wrker.PRIVATE_URL}
+services:
+- name: api
+  image:
+    registry_type: DOCR
+    repository: api
+    tag: v1
+    digest: sha256:1234
+  routes:
+  - path: /api/
+workers:
+- name: api
+- name: -worker
+ingress:
+  rules:
+  - match:
+      path:
+        prefix: /api
+    component:
+      name: frontend
+`,
+		expected: []string{
+			`1:1: name: name "Foo_App" must be 2 to 32 characters long, consist of lowercase letters, digits and dashes, start with a letter and end with a letter or digit`,
+			`15:3: workers.0.name: component name "api" is used more than once`,
+			`16:3: workers.1.name: name "-worker" must be 2 to 32 characters long, consist of lowercase letters, digits and dashes, start with a letter and end with a letter or digit`,
+			`11:5: services.0.image.digest: image must not define both a tag and a digest`,
+			`23:7: ingress.rules.0.component.name: ingress rule routes to unknown component "frontend"`,
+			`13:5: services.0.routes.0.path: route "/api/" collides with another route`,
+			`4:3: envs.0.value: ${wrker.PRIVATE_URL} references unknown component "wrker"`,
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			specFilePath := filepath.Join(t.TempDir(), "app.yaml")
+			require.NoError(t, os.WriteFile(specFilePath, []byte(test.spec), 0644))
+
+			d := &deployer{inputs: inputs{appSpecLocation: specFilePath, strictSpec: true}}
+			_, err := d.createSpec(context.Background())
+			if len(test.expected) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+
+			var actionLogs bytes.Buffer
+			annotateSpecProblems(gha.New(gha.WithWriter(&actionLogs)), err)
+
+			var expectedLogs string
+			for _, e := range test.expected {
+				var line, col int
+				var msg string
+				_, scanErr := fmt.Sscanf(e, "%d:%d:", &line, &col)
+				require.NoError(t, scanErr)
+				msg = e[strings.Index(e, ": ")+2:]
+				expectedLogs += fmt.Sprintf("::error col=%d,file=%s,line=%d::%s\n", col, specFilePath, line, msg)
+			}
+			require.Equal(t, expectedLogs, actionLogs.String())
+		})
+	}
+}
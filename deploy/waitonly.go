@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/digitalocean/app_action/utils"
+	"github.com/digitalocean/godo"
+)
+
+// pushDeploymentTimeout is how long to wait for a deployment of the current commit
+// to show up.
+const pushDeploymentTimeout = 10 * time.Minute
+
+// waitForPushDeployment waits for the deployment of the current commit to finish
+// without changing the app. The deployment is expected to be triggered by the
+// push itself, via deploy_on_push.
+func (d *deployer) waitForPushDeployment(ctx context.Context, appName string) (*deployResult, error) {
+	sha := d.action.Getenv("GITHUB_SHA")
+	if sha == "" {
+		return nil, fmt.Errorf("GITHUB_SHA is not set")
+	}
+	app, err := utils.FindAppByName(ctx, d.apps, appName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get app: %w", err)
+	}
+	if app == nil {
+		return nil, fmt.Errorf("app %q does not exist", appName)
+	}
+
+	d.action.Infof("wait for deployment of commit %s of app %q", sha, appName)
+	dep, err := d.findCommitDeployment(ctx, app.GetID(), sha)
+	if err != nil {
+		return nil, err
+	}
+	d.action.Infof("found deployment %s of commit %s", dep.GetID(), sha)
+	return d.awaitDeployment(ctx, app, dep.GetID(), false)
+}
+
+// findCommitDeployment finds the latest deployment of the given app that deploys
+// the given commit, waiting for it to show up if necessary.
+func (d *deployer) findCommitDeployment(ctx context.Context, appID, sha string) (*godo.Deployment, error) {
+	ctx, cancel := context.WithTimeout(ctx, pushDeploymentTimeout)
+	defer cancel()
+	p := d.newPoller()
+
+	for {
+		ds, resp, err := d.apps.ListDeployments(ctx, appID, &godo.ListOptions{PerPage: 20})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list deployments: %w", err)
+		}
+		// Deployments are listed newest first.
+		for _, dep := range ds {
+			if deploysCommit(dep, sha) {
+				return dep, nil
+			}
+		}
+
+		if err := p.wait(ctx, resp, false); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return nil, fmt.Errorf("no deployment of commit %s found within %s, is deploy_on_push enabled?", sha, pushDeploymentTimeout)
+			}
+			return nil, err
+		}
+	}
+}
+
+// deploysCommit returns whether any component of the given deployment deploys the
+// given commit.
+func deploysCommit(dep *godo.Deployment, sha string) bool {
+	for _, commit := range deployedCommits(dep) {
+		if commit != "" && (strings.HasPrefix(sha, commit) || strings.HasPrefix(commit, sha)) {
+			return true
+		}
+	}
+	return false
+}
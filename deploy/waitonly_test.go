@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+	gha "github.com/sethvargo/go-githubactions"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitForPushDeployment(t *testing.T) {
+	ctx := context.Background()
+	appID := "app-id"
+	sha := "0123456789abcdef"
+
+	as := &mockedAppsService{}
+	as.On("List", ctx, mock.Anything).Return([]*godo.App{{
+		ID:   appID,
+		Spec: &godo.AppSpec{Name: "foo"},
+	}}, &godo.Response{}, nil)
+	// The deployment of the commit only shows up after a while.
+	as.On("ListDeployments", mock.Anything, appID, mock.Anything).Return([]*godo.Deployment{{
+		ID:       "old",
+		Services: []*godo.DeploymentService{{Name: "web", SourceCommitHash: "fedcba9876543210"}},
+	}}, &godo.Response{}, nil).Once()
+	as.On("ListDeployments", mock.Anything, appID, mock.Anything).Return([]*godo.Deployment{{
+		ID:       "new",
+		Services: []*godo.DeploymentService{{Name: "web", SourceCommitHash: sha}},
+	}, {
+		ID:       "old",
+		Services: []*godo.DeploymentService{{Name: "web", SourceCommitHash: "fedcba9876543210"}},
+	}}, &godo.Response{}, nil).Once()
+	as.On("GetDeployment", ctx, appID, "new").Return(&godo.Deployment{
+		ID:    "new",
+		Phase: godo.DeploymentPhase_Active,
+	}, &godo.Response{}, nil)
+	as.On("GetLogs", ctx, appID, "new", "", mock.Anything, true, -1).Return(&godo.AppLogs{}, &godo.Response{}, nil)
+	as.On("Get", ctx, appID).Return(&godo.App{ID: appID, LiveURL: "https://example.com"}, &godo.Response{}, nil)
+
+	var actionLogs bytes.Buffer
+	d := &deployer{
+		action: gha.New(gha.WithWriter(&actionLogs), gha.WithGetenv(func(k string) string {
+			if k == "GITHUB_SHA" {
+				return sha
+			}
+			return ""
+		})),
+		apps:   as,
+		inputs: inputs{pollInterval: time.Millisecond},
+	}
+	res, err := d.waitForPushDeployment(ctx, "foo")
+	require.NoError(t, err)
+	require.Equal(t, &deployResult{
+		App:        &godo.App{ID: appID, LiveURL: "https://example.com"},
+		Deployment: &godo.Deployment{ID: "new", Phase: godo.DeploymentPhase_Active},
+	}, res)
+	require.Equal(t, `wait for deployment of commit 0123456789abcdef of app "foo"
+found deployment new of commit 0123456789abcdef
+wait for deployment to finish
+deployment is in phase: ACTIVE
+`, actionLogs.String())
+	// The app wasn't changed.
+	as.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+	as.AssertNotCalled(t, "CreateDeployment", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDeploysCommit(t *testing.T) {
+	dep := &godo.Deployment{
+		Services:    []*godo.DeploymentService{{Name: "web"}},
+		StaticSites: []*godo.DeploymentStaticSite{{Name: "site", SourceCommitHash: "0123456789abcdef"}},
+	}
+	require.True(t, deploysCommit(dep, "0123456789abcdef"))
+	require.True(t, deploysCommit(dep, "0123456"))
+	require.False(t, deploysCommit(dep, "fedcba9876543210"))
+}
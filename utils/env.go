@@ -14,22 +14,67 @@ var appWideVariables = map[string]struct{}{
 	"APP_ID":   {},
 }
 
+// UnresolvedVariable is a variable reference that expanded to an empty string.
+type UnresolvedVariable struct {
+	// Name is the name of the variable.
+	Name string
+	// Required is true if the reference was marked as required via `${VAR:?message}`.
+	Required bool
+	// Message is the message of a required reference.
+	Message string
+}
+
 // ExpandEnvRetainingBindables expands the environment variables in s, but it
 // keeps bindable variables intact.
 // Since bindable variables look like env vars, notation-wise, we just don't
 // expand them at all.
 func ExpandEnvRetainingBindables(s string) string {
-	return os.Expand(s, func(name string) string {
-		value := os.Getenv(name)
-		if value == "" {
+	expanded, _ := ExpandRetainingBindables(s, os.Getenv)
+	return expanded
+}
+
+// ExpandRetainingBindables is like ExpandEnvRetainingBindables but looks up
+// the variables via the given function rather than the environment. It also
+// returns all references that expanded to an empty string, in order of their
+// first occurrence. Bindable variables are never reported.
+//
+// Shell-style defaults (`${VAR:-default}`) and required markers
+// (`${VAR:?message}`) are supported.
+func ExpandRetainingBindables(s string, getenv func(string) string) (string, []UnresolvedVariable) {
+	var unresolved []UnresolvedVariable
+	seen := make(map[string]struct{})
+	expanded := os.Expand(s, func(name string) string {
+		var def, msg string
+		var hasDefault, required bool
+		if n, d, ok := strings.Cut(name, ":-"); ok {
+			name, def, hasDefault = n, d, true
+		} else if n, m, ok := strings.Cut(name, ":?"); ok {
+			name, msg, required = n, m, true
+		}
+
+		value := getenv(name)
+		if value != "" {
+			return value
+		}
+		if hasDefault {
+			// Like in shells, an explicitly empty default counts as resolved.
+			return def
+		}
+		if !required {
 			if _, ok := appWideVariables[name]; ok || looksLikeBindable(name) {
 				// If the environment variable is not set, keep the respective
 				// reference intact.
 				return fmt.Sprintf("${%s}", name)
 			}
 		}
-		return value
+
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			unresolved = append(unresolved, UnresolvedVariable{Name: name, Required: required, Message: msg})
+		}
+		return ""
 	})
+	return expanded, unresolved
 }
 
 // looksLikeBindable returns true if the key looks like a bindable variable.
@@ -66,3 +66,54 @@ func TestExpandEnvRetainingBindablesAppWideVariables(t *testing.T) {
 		})
 	}
 }
+
+func TestExpandRetainingBindables(t *testing.T) {
+	getenv := func(name string) string {
+		if name == "LIVE_URL_API" {
+			return "https://api.example.com"
+		}
+		return ""
+	}
+
+	tests := []struct {
+		name       string
+		in         string
+		out        string
+		unresolved []UnresolvedVariable
+	}{{
+		name: "custom lookup",
+		in:   "api: ${LIVE_URL_API}, self: ${APP_URL}, other: ${web.HOSTNAME}",
+		out:  "api: https://api.example.com, self: ${APP_URL}, other: ${web.HOSTNAME}",
+	}, {
+		name:       "unresolved",
+		in:         "a: ${FOO}, b: $BAR, c: ${FOO}",
+		out:        "a: , b: , c: ",
+		unresolved: []UnresolvedVariable{{Name: "FOO"}, {Name: "BAR"}},
+	}, {
+		name: "default",
+		in:   "a: ${FOO:-foo.example.com}, b: ${LIVE_URL_API:-unused}",
+		out:  "a: foo.example.com, b: https://api.example.com",
+	}, {
+		name: "empty default",
+		in:   "a: ${FOO:-}, b: ${web.HOSTNAME:-}",
+		out:  "a: , b: ",
+	}, {
+		name:       "required",
+		in:         "a: ${FOO:?must be set to the API token}, b: ${LIVE_URL_API:?unused}",
+		out:        "a: , b: https://api.example.com",
+		unresolved: []UnresolvedVariable{{Name: "FOO", Required: true, Message: "must be set to the API token"}},
+	}, {
+		name:       "required app-wide variable",
+		in:         "${APP_URL:?must be set}",
+		out:        "",
+		unresolved: []UnresolvedVariable{{Name: "APP_URL", Required: true, Message: "must be set"}},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, unresolved := ExpandRetainingBindables(test.in, getenv)
+			require.Equal(t, test.out, got)
+			require.Equal(t, test.unresolved, unresolved)
+		})
+	}
+}
@@ -3,6 +3,8 @@ package utils
 import (
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	gha "github.com/sethvargo/go-githubactions"
 )
@@ -36,3 +38,66 @@ func InputAsBool(a *gha.Action, input string, required bool, target *bool) error
 	*target = val
 	return nil
 }
+
+// InputAsInt parses the input as an integer and sets the target.
+func InputAsInt(a *gha.Action, input string, required bool, target *int) error {
+	str := a.GetInput(input)
+	if str == "" {
+		if required {
+			return fmt.Errorf("input %q is required", input)
+		}
+
+		// If the input is not required, we default to 0.
+		*target = 0
+		return nil
+	}
+	val, err := strconv.Atoi(str)
+	if err != nil {
+		return fmt.Errorf("failed to parse %q as an integer: %v", input, err)
+	}
+	*target = val
+	return nil
+}
+
+// InputAsDuration parses the input as a duration, like "2s", and sets the target.
+func InputAsDuration(a *gha.Action, input string, required bool, target *time.Duration) error {
+	str := a.GetInput(input)
+	if str == "" {
+		if required {
+			return fmt.Errorf("input %q is required", input)
+		}
+
+		// If the input is not required, we default to 0.
+		*target = 0
+		return nil
+	}
+	val, err := time.ParseDuration(str)
+	if err != nil {
+		return fmt.Errorf("failed to parse %q as a duration: %v", input, err)
+	}
+	*target = val
+	return nil
+}
+
+// InputAsList parses the input as a list of strings and sets the target.
+// Items can be separated by newlines or commas. Surrounding whitespace and
+// empty items are dropped.
+func InputAsList(a *gha.Action, input string, required bool, target *[]string) error {
+	str := a.GetInput(input)
+	if str == "" && required {
+		return fmt.Errorf("input %q is required", input)
+	}
+	*target = splitList(str)
+	return nil
+}
+
+// splitList splits the given string into its newline or comma separated items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.FieldsFunc(s, func(r rune) bool { return r == '\n' || r == ',' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
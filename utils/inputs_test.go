@@ -2,6 +2,7 @@ package utils
 
 import (
 	"testing"
+	"time"
 
 	gha "github.com/sethvargo/go-githubactions"
 	"github.com/stretchr/testify/require"
@@ -109,3 +110,167 @@ func TestInputAsBool(t *testing.T) {
 		})
 	}
 }
+
+func TestInputAsInt(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		required bool
+		expected int
+		err      bool
+	}{{
+		name:     "success",
+		input:    "input",
+		required: true,
+		expected: 42,
+	}, {
+		name:     "required",
+		input:    "empty",
+		required: true,
+		err:      true,
+	}, {
+		name:     "optional",
+		input:    "empty",
+		required: false,
+		expected: 0,
+	}, {
+		name:     "invalid",
+		input:    "invalid",
+		required: true,
+		err:      true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := gha.New(gha.WithGetenv(func(k string) string {
+				switch k {
+				case "INPUT_INPUT":
+					return "42"
+				case "INPUT_EMPTY":
+					return ""
+				case "INPUT_INVALID":
+					return "invalid"
+				default:
+					return "unexpected"
+				}
+			}))
+			var target int
+			err := InputAsInt(a, test.input, test.required, &target)
+			if !test.err {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+			require.Equal(t, test.expected, target)
+		})
+	}
+}
+
+func TestInputAsDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		required bool
+		expected time.Duration
+		err      bool
+	}{{
+		name:     "success",
+		input:    "input",
+		required: true,
+		expected: 1500 * time.Millisecond,
+	}, {
+		name:     "required",
+		input:    "empty",
+		required: true,
+		err:      true,
+	}, {
+		name:     "optional",
+		input:    "empty",
+		required: false,
+		expected: 0,
+	}, {
+		name:     "invalid",
+		input:    "invalid",
+		required: true,
+		err:      true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := gha.New(gha.WithGetenv(func(k string) string {
+				switch k {
+				case "INPUT_INPUT":
+					return "1.5s"
+				case "INPUT_EMPTY":
+					return ""
+				case "INPUT_INVALID":
+					return "invalid"
+				default:
+					return "unexpected"
+				}
+			}))
+			var target time.Duration
+			err := InputAsDuration(a, test.input, test.required, &target)
+			if !test.err {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+			require.Equal(t, test.expected, target)
+		})
+	}
+}
+
+func TestInputAsList(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		required bool
+		expected []string
+		err      bool
+	}{{
+		name:     "newlines",
+		input:    "newlines",
+		required: true,
+		expected: []string{"a", "b", "c"},
+	}, {
+		name:     "commas",
+		input:    "commas",
+		required: true,
+		expected: []string{"a", "b", "c"},
+	}, {
+		name:     "required",
+		input:    "empty",
+		required: true,
+		err:      true,
+	}, {
+		name:     "optional",
+		input:    "empty",
+		required: false,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := gha.New(gha.WithGetenv(func(k string) string {
+				switch k {
+				case "INPUT_NEWLINES":
+					return "a\n  b\n\nc\n"
+				case "INPUT_COMMAS":
+					return "a, b,,c"
+				case "INPUT_EMPTY":
+					return ""
+				default:
+					return "unexpected"
+				}
+			}))
+			var target []string
+			err := InputAsList(a, test.input, test.required, &target)
+			if !test.err {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+			require.Equal(t, test.expected, target)
+		})
+	}
+}
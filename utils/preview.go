@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/digitalocean/godo"
@@ -81,14 +82,48 @@ func GenerateAppName(repoOwner, repo, ref string) string {
 // on merge events, which isn't the case for the RefName attribute.
 // See: https://docs.github.com/en/actions/writing-workflows/choosing-when-your-workflow-runs/events-that-trigger-workflows#pull_request.
 func PRRefFromContext(ghCtx *gha.GitHubContext) (string, error) {
+	prNumber, err := PRNumberFromContext(ghCtx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d/merge", prNumber), nil
+}
+
+// PRNumberFromContext extracts the PR number from the given GitHub context.
+func PRNumberFromContext(ghCtx *gha.GitHubContext) (int, error) {
 	prFields, ok := ghCtx.Event["pull_request"].(map[string]any)
 	if !ok {
-		return "", fmt.Errorf("pull_request field didn't exist on event: %v", ghCtx.Event)
+		return 0, fmt.Errorf("pull_request field didn't exist on event: %v", ghCtx.Event)
 	}
 	// The event is parsed as a JSON object and Golang represents numbers as float64.
 	prNumber, ok := prFields["number"].(float64)
 	if !ok {
-		return "", errors.New("missing pull request number")
+		return 0, errors.New("missing pull request number")
 	}
-	return fmt.Sprintf("%d/merge", int(prNumber)), nil
+	return int(prNumber), nil
+}
+
+// PreviewDomainFromTemplate renders the given domain template for the PR in the
+// given GitHub context. The template may contain a `{number}` placeholder, which
+// is replaced by the PR number.
+func PreviewDomainFromTemplate(template string, ghCtx *gha.GitHubContext) (string, error) {
+	prNumber, err := PRNumberFromContext(ghCtx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get PR number: %w", err)
+	}
+	domain := strings.ToLower(strings.ReplaceAll(template, "{number}", strconv.Itoa(prNumber)))
+	if strings.ContainsAny(domain, "{}") {
+		return "", fmt.Errorf("domain template %q contains unknown placeholders", template)
+	}
+	return domain, nil
+}
+
+// SetPreviewDomain sets the given domain as the only domain of the given AppSpec.
+// If zone is set, App Platform manages the respective DNS records in that zone.
+func SetPreviewDomain(spec *godo.AppSpec, domain, zone string) {
+	spec.Domains = []*godo.AppDomainSpec{{
+		Domain: domain,
+		Type:   godo.AppDomainSpecType_Primary,
+		Zone:   zone,
+	}}
 }
@@ -154,3 +154,48 @@ func TestGenerateAppName(t *testing.T) {
 		})
 	}
 }
+
+func TestPreviewDomainFromTemplate(t *testing.T) {
+	ghCtx := &gha.GitHubContext{
+		Event: map[string]any{
+			"pull_request": map[string]any{
+				"number": float64(3),
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+		err      bool
+	}{{
+		name:     "success",
+		template: "pr-{number}.preview.example.com",
+		expected: "pr-3.preview.example.com",
+	}, {
+		name:     "uppercase",
+		template: "PR-{number}.Preview.example.com",
+		expected: "pr-3.preview.example.com",
+	}, {
+		name:     "no placeholder",
+		template: "preview.example.com",
+		expected: "preview.example.com",
+	}, {
+		name:     "unknown placeholder",
+		template: "pr-{branch}.preview.example.com",
+		err:      true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := PreviewDomainFromTemplate(test.template, ghCtx)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, got)
+		})
+	}
+}
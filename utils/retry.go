@@ -0,0 +1,226 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+// Defaults of RetryingAppsService.
+const (
+	defaultMaxAttempts = 5
+	defaultRetryBudget = 50
+	defaultBaseDelay   = time.Second
+	defaultMaxDelay    = 30 * time.Second
+)
+
+// RetryingAppsService wraps an AppsService and retries calls that failed
+// transiently with exponential backoff and jitter, honoring Retry-After headers.
+//
+// Rate limited calls (429) are always retried, since the API rejected them.
+// Server errors (5xx) and network errors are only retried for idempotent calls.
+// Creating, updating or deleting an app and creating a deployment might have
+// succeeded nonetheless, so retrying them could trigger another deployment or
+// fail since the app is gone.
+type RetryingAppsService struct {
+	godo.AppsService
+
+	// MaxAttempts is the maximum number of attempts per call.
+	MaxAttempts int
+	// Budget is the maximum number of retries across all calls, so a failing
+	// API doesn't multiply the runtime of long polling loops.
+	Budget int
+	// BaseDelay is the delay before the first retry. It doubles with every retry
+	// up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Logf logs retries, if set.
+	Logf func(format string, args ...any)
+
+	retries atomic.Int64
+	// sleep waits for the given duration or until the context is done.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewRetryingAppsService returns a RetryingAppsService with the default settings,
+// logging retries to logf.
+func NewRetryingAppsService(apps godo.AppsService, logf func(format string, args ...any)) *RetryingAppsService {
+	return &RetryingAppsService{
+		AppsService: apps,
+		MaxAttempts: defaultMaxAttempts,
+		Budget:      defaultRetryBudget,
+		BaseDelay:   defaultBaseDelay,
+		MaxDelay:    defaultMaxDelay,
+		Logf:        logf,
+	}
+}
+
+// Retries returns the number of retries done so far.
+func (s *RetryingAppsService) Retries() int {
+	return int(s.retries.Load())
+}
+
+// Create creates an app, retrying if rate limited.
+func (s *RetryingAppsService) Create(ctx context.Context, create *godo.AppCreateRequest) (*godo.App, *godo.Response, error) {
+	return retryCall(ctx, s, "Create", false, func() (*godo.App, *godo.Response, error) {
+		return s.AppsService.Create(ctx, create)
+	})
+}
+
+// Get gets an app, retrying transient failures.
+func (s *RetryingAppsService) Get(ctx context.Context, appID string) (*godo.App, *godo.Response, error) {
+	return retryCall(ctx, s, "Get", true, func() (*godo.App, *godo.Response, error) {
+		return s.AppsService.Get(ctx, appID)
+	})
+}
+
+// List lists apps, retrying transient failures.
+func (s *RetryingAppsService) List(ctx context.Context, opts *godo.ListOptions) ([]*godo.App, *godo.Response, error) {
+	return retryCall(ctx, s, "List", true, func() ([]*godo.App, *godo.Response, error) {
+		return s.AppsService.List(ctx, opts)
+	})
+}
+
+// Update updates an app, retrying if rate limited.
+func (s *RetryingAppsService) Update(ctx context.Context, appID string, update *godo.AppUpdateRequest) (*godo.App, *godo.Response, error) {
+	return retryCall(ctx, s, "Update", false, func() (*godo.App, *godo.Response, error) {
+		return s.AppsService.Update(ctx, appID, update)
+	})
+}
+
+// Delete deletes an app, retrying if rate limited.
+func (s *RetryingAppsService) Delete(ctx context.Context, appID string) (*godo.Response, error) {
+	_, resp, err := retryCall(ctx, s, "Delete", false, func() (struct{}, *godo.Response, error) {
+		resp, err := s.AppsService.Delete(ctx, appID)
+		return struct{}{}, resp, err
+	})
+	return resp, err
+}
+
+// GetDeployment gets a deployment, retrying transient failures.
+func (s *RetryingAppsService) GetDeployment(ctx context.Context, appID, deploymentID string) (*godo.Deployment, *godo.Response, error) {
+	return retryCall(ctx, s, "GetDeployment", true, func() (*godo.Deployment, *godo.Response, error) {
+		return s.AppsService.GetDeployment(ctx, appID, deploymentID)
+	})
+}
+
+// ListDeployments lists deployments, retrying transient failures.
+func (s *RetryingAppsService) ListDeployments(ctx context.Context, appID string, opts *godo.ListOptions) ([]*godo.Deployment, *godo.Response, error) {
+	return retryCall(ctx, s, "ListDeployments", true, func() ([]*godo.Deployment, *godo.Response, error) {
+		return s.AppsService.ListDeployments(ctx, appID, opts)
+	})
+}
+
+// CreateDeployment creates a deployment, retrying if rate limited.
+func (s *RetryingAppsService) CreateDeployment(ctx context.Context, appID string, create ...*godo.DeploymentCreateRequest) (*godo.Deployment, *godo.Response, error) {
+	return retryCall(ctx, s, "CreateDeployment", false, func() (*godo.Deployment, *godo.Response, error) {
+		return s.AppsService.CreateDeployment(ctx, appID, create...)
+	})
+}
+
+// GetLogs gets the logs of a deployment, retrying transient failures.
+func (s *RetryingAppsService) GetLogs(ctx context.Context, appID, deploymentID, component string, logType godo.AppLogType, follow bool, tailLines int) (*godo.AppLogs, *godo.Response, error) {
+	return retryCall(ctx, s, "GetLogs", true, func() (*godo.AppLogs, *godo.Response, error) {
+		return s.AppsService.GetLogs(ctx, appID, deploymentID, component, logType, follow, tailLines)
+	})
+}
+
+// retryCall calls fn until it succeeds, fails permanently or runs out of attempts.
+func retryCall[T any](ctx context.Context, s *RetryingAppsService, name string, idempotent bool, fn func() (T, *godo.Response, error)) (T, *godo.Response, error) {
+	for attempt := 1; ; attempt++ {
+		v, resp, err := fn()
+		if err == nil || attempt >= s.MaxAttempts || !retryable(ctx, resp, err, idempotent) {
+			return v, resp, err
+		}
+		retries := s.retries.Add(1)
+		if retries > int64(s.Budget) {
+			s.retries.Add(-1)
+			return v, resp, err
+		}
+
+		delay := s.backoff(attempt)
+		if retryAfter := retryAfter(resp); retryAfter > delay {
+			delay = retryAfter
+		}
+		if s.Logf != nil {
+			s.Logf("retrying %s in %s after attempt %d of %d failed (%d of %d retries used): %v", name, delay.Round(time.Millisecond), attempt, s.MaxAttempts, retries, s.Budget, err)
+		}
+		sleep := s.sleep
+		if sleep == nil {
+			sleep = SleepContext
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return v, resp, err
+		}
+	}
+}
+
+// backoff returns the delay before the given retry, which doubles with every
+// attempt. Jitter spreads the retries of concurrent workflows.
+func (s *RetryingAppsService) backoff(attempt int) time.Duration {
+	delay := s.MaxDelay
+	if shift := attempt - 1; shift < 32 && s.BaseDelay<<shift < s.MaxDelay {
+		delay = s.BaseDelay << shift
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// retryable returns whether the call that resulted in the given response and
+// error is worth retrying.
+func retryable(ctx context.Context, resp *godo.Response, err error, idempotent bool) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var status int
+	var errResp *godo.ErrorResponse
+	switch {
+	case errors.As(err, &errResp) && errResp.Response != nil:
+		status = errResp.Response.StatusCode
+	case resp != nil && resp.Response != nil:
+		status = resp.StatusCode
+	default:
+		// Without a response, the request failed on the network.
+		return idempotent
+	}
+	return status == http.StatusTooManyRequests || (idempotent && status >= http.StatusInternalServerError)
+}
+
+// retryAfter returns the delay the given response asks for via its Retry-After
+// header, if any.
+func retryAfter(resp *godo.Response) time.Duration {
+	if resp == nil || resp.Response == nil {
+		return 0
+	}
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// SleepContext waits for the given duration or until the context is done.
+func SleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
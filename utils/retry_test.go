@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryingAppsService(t *testing.T) {
+	ctx := context.Background()
+	errorResponse := func(status int, header http.Header) (*godo.Response, error) {
+		resp := &http.Response{StatusCode: status, Header: header}
+		return &godo.Response{Response: resp}, &godo.ErrorResponse{Response: resp, Message: http.StatusText(status)}
+	}
+	newService := func(as *mockedAppsService, delays *[]time.Duration) *RetryingAppsService {
+		s := NewRetryingAppsService(as, nil)
+		s.sleep = func(_ context.Context, d time.Duration) error {
+			*delays = append(*delays, d)
+			return nil
+		}
+		return s
+	}
+
+	t.Run("retries server errors", func(t *testing.T) {
+		as := &mockedAppsService{}
+		resp, err := errorResponse(http.StatusServiceUnavailable, nil)
+		as.On("GetDeployment", ctx, "app", "dep").Return(&godo.Deployment{}, resp, err).Twice()
+		as.On("GetDeployment", ctx, "app", "dep").Return(&godo.Deployment{ID: "dep"}, &godo.Response{}, nil).Once()
+		var delays []time.Duration
+		s := newService(as, &delays)
+
+		dep, _, err := s.GetDeployment(ctx, "app", "dep")
+		require.NoError(t, err)
+		require.Equal(t, "dep", dep.GetID())
+		require.Equal(t, 2, s.Retries())
+		require.Len(t, delays, 2)
+		require.GreaterOrEqual(t, delays[0], defaultBaseDelay/2)
+		require.LessOrEqual(t, delays[0], defaultBaseDelay)
+		require.GreaterOrEqual(t, delays[1], defaultBaseDelay)
+		require.LessOrEqual(t, delays[1], 2*defaultBaseDelay)
+		as.AssertExpectations(t)
+	})
+
+	t.Run("honors Retry-After", func(t *testing.T) {
+		as := &mockedAppsService{}
+		resp, err := errorResponse(http.StatusTooManyRequests, http.Header{"Retry-After": []string{"10"}})
+		as.On("CreateDeployment", ctx, "app").Return(&godo.Deployment{}, resp, err).Once()
+		as.On("CreateDeployment", ctx, "app").Return(&godo.Deployment{ID: "dep"}, &godo.Response{}, nil).Once()
+		var delays []time.Duration
+		s := newService(as, &delays)
+
+		_, _, err = s.CreateDeployment(ctx, "app")
+		require.NoError(t, err)
+		require.Equal(t, []time.Duration{10 * time.Second}, delays)
+		as.AssertExpectations(t)
+	})
+
+	t.Run("doesn't retry server errors of non-idempotent calls", func(t *testing.T) {
+		as := &mockedAppsService{}
+		resp, err := errorResponse(http.StatusInternalServerError, nil)
+		as.On("CreateDeployment", ctx, "app").Return(&godo.Deployment{}, resp, err).Once()
+		var delays []time.Duration
+		s := newService(as, &delays)
+
+		_, _, err = s.CreateDeployment(ctx, "app")
+		require.Error(t, err)
+		require.Equal(t, 0, s.Retries())
+		as.AssertExpectations(t)
+	})
+
+	t.Run("doesn't retry server errors of deletes", func(t *testing.T) {
+		as := &mockedAppsService{}
+		resp, err := errorResponse(http.StatusServiceUnavailable, nil)
+		as.On("Delete", ctx, "app").Return(resp, err).Once()
+		var delays []time.Duration
+		s := newService(as, &delays)
+
+		_, err = s.Delete(ctx, "app")
+		require.Error(t, err)
+		require.Equal(t, 0, s.Retries())
+		as.AssertExpectations(t)
+	})
+
+	t.Run("doesn't retry server errors of updates", func(t *testing.T) {
+		as := &mockedAppsService{}
+		resp, err := errorResponse(http.StatusBadGateway, nil)
+		as.On("Update", ctx, "app", mock.Anything).Return(&godo.App{}, resp, err).Once()
+		var delays []time.Duration
+		s := newService(as, &delays)
+
+		_, _, err = s.Update(ctx, "app", &godo.AppUpdateRequest{})
+		require.Error(t, err)
+		require.Equal(t, 0, s.Retries())
+		as.AssertExpectations(t)
+	})
+
+	t.Run("doesn't retry client errors", func(t *testing.T) {
+		as := &mockedAppsService{}
+		resp, err := errorResponse(http.StatusNotFound, nil)
+		as.On("GetDeployment", ctx, "app", "dep").Return(&godo.Deployment{}, resp, err).Once()
+		var delays []time.Duration
+		s := newService(as, &delays)
+
+		_, _, err = s.GetDeployment(ctx, "app", "dep")
+		require.Error(t, err)
+		require.Empty(t, delays)
+		as.AssertExpectations(t)
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		as := &mockedAppsService{}
+		as.On("List", ctx, mock.Anything).Return([]*godo.App{}, (*godo.Response)(nil), errors.New("connection reset")).Times(defaultMaxAttempts)
+		var delays []time.Duration
+		s := newService(as, &delays)
+
+		_, _, err := s.List(ctx, &godo.ListOptions{})
+		require.EqualError(t, err, "connection reset")
+		require.Len(t, delays, defaultMaxAttempts-1)
+		as.AssertExpectations(t)
+	})
+
+	t.Run("respects the retry budget", func(t *testing.T) {
+		as := &mockedAppsService{}
+		resp, err := errorResponse(http.StatusBadGateway, nil)
+		as.On("GetDeployment", ctx, "app", "dep").Return(&godo.Deployment{}, resp, err)
+		var delays []time.Duration
+		s := newService(as, &delays)
+		s.Budget = 3
+
+		_, _, err = s.GetDeployment(ctx, "app", "dep")
+		require.Error(t, err)
+		_, _, err = s.GetDeployment(ctx, "app", "dep")
+		require.Error(t, err)
+		require.Equal(t, 3, s.Retries())
+		as.AssertNumberOfCalls(t, "GetDeployment", 5)
+	})
+}
+
+func (m *mockedAppsService) GetDeployment(ctx context.Context, appID, deploymentID string) (*godo.Deployment, *godo.Response, error) {
+	args := m.Called(ctx, appID, deploymentID)
+	return args.Get(0).(*godo.Deployment), args.Get(1).(*godo.Response), args.Error(2)
+}
+
+func (m *mockedAppsService) CreateDeployment(ctx context.Context, appID string, create ...*godo.DeploymentCreateRequest) (*godo.Deployment, *godo.Response, error) {
+	args := m.Called(ctx, appID)
+	return args.Get(0).(*godo.Deployment), args.Get(1).(*godo.Response), args.Error(2)
+}
+
+func (m *mockedAppsService) Update(ctx context.Context, appID string, update *godo.AppUpdateRequest) (*godo.App, *godo.Response, error) {
+	args := m.Called(ctx, appID, update)
+	return args.Get(0).(*godo.App), args.Get(1).(*godo.Response), args.Error(2)
+}
+
+func (m *mockedAppsService) Delete(ctx context.Context, appID string) (*godo.Response, error) {
+	args := m.Called(ctx, appID)
+	return args.Get(0).(*godo.Response), args.Error(1)
+}
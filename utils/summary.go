@@ -0,0 +1,15 @@
+package utils
+
+import (
+	gha "github.com/sethvargo/go-githubactions"
+)
+
+// AddStepSummary appends the given markdown to the job summary. It's a no-op if
+// the job summary is not available, for example when running outside of GitHub
+// Actions.
+func AddStepSummary(a *gha.Action, markdown string) {
+	if a.Getenv("GITHUB_STEP_SUMMARY") == "" {
+		return
+	}
+	a.AddStepSummary(markdown)
+}